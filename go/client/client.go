@@ -0,0 +1,158 @@
+// Package client is the Go client of the pcbook server. It wraps the streaming RPCs of the laptop service
+// into typed methods, and authenticates the RPCs with the token of Login, or with the credentials or the login
+// of the options.
+//
+// The errors of the RPCs are the gRPC status errors of the server, whose code can be read with status.Code.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultChunkSize is the size of the chunks images are uploaded in
+const DefaultChunkSize = 32 << 10
+
+// Client calls the laptop and auth services of a pcbook server. It is safe for concurrent use.
+type Client struct {
+	conn      *grpc.ClientConn
+	laptops   pb.LaptopServiceClient
+	auth      pb.AuthServiceClient
+	chunkSize int
+	// session holds the token of Login, unless the credentials are given by the options
+	session *sessionCredentials
+	// tokenSource keeps the token of the user of WithLogin fresh
+	tokenSource *TokenSource
+}
+
+// options configure a client
+type options struct {
+	transportCredentials credentials.TransportCredentials
+	credentials          credentials.PerRPCCredentials
+	dialOptions          []grpc.DialOption
+	chunkSize            int
+	username             string
+	password             string
+}
+
+// Option configures a client
+type Option func(*options)
+
+// WithTransportCredentials secures the connection, such as with the credentials of LoadTLSCredentials.
+// The connection is insecure by default.
+func WithTransportCredentials(transportCredentials credentials.TransportCredentials) Option {
+	return func(opts *options) {
+		opts.transportCredentials = transportCredentials
+	}
+}
+
+// WithCredentials authenticates the RPCs with the credentials, such as Token or APIKey, instead of the token of Login
+func WithCredentials(perRPCCredentials credentials.PerRPCCredentials) Option {
+	return func(opts *options) {
+		opts.credentials = perRPCCredentials
+	}
+}
+
+// WithLogin authenticates the RPCs as the user, who logs in with the first RPC. The token is kept fresh
+// by a TokenSource until the client is closed.
+func WithLogin(username string, password string) Option {
+	return func(opts *options) {
+		opts.username = username
+		opts.password = password
+	}
+}
+
+// WithDialOptions adds options to the connection, such as interceptors
+func WithDialOptions(dialOptions ...grpc.DialOption) Option {
+	return func(opts *options) {
+		opts.dialOptions = append(opts.dialOptions, dialOptions...)
+	}
+}
+
+// WithChunkSize sets the size of the chunks images are uploaded in, DefaultChunkSize by default
+func WithChunkSize(chunkSize int) Option {
+	return func(opts *options) {
+		opts.chunkSize = chunkSize
+	}
+}
+
+// New returns a client of the server at the address. The connection is established lazily, by the first RPC.
+func New(address string, opts ...Option) (*Client, error) {
+	config := options{
+		transportCredentials: insecure.NewCredentials(),
+		chunkSize:            DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", config.chunkSize)
+	}
+	if config.username != "" && config.credentials != nil {
+		return nil, errors.New("the credentials and the login options are exclusive")
+	}
+
+	client := &Client{chunkSize: config.chunkSize}
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(config.transportCredentials)}
+	switch {
+	case config.username != "":
+		// Logging in goes through the connection, whose interceptors leave the Login RPC alone
+		client.tokenSource = newTokenSource(config.username, config.password)
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(client.tokenSource.Unary()),
+			grpc.WithChainStreamInterceptor(client.tokenSource.Stream()),
+		)
+	case config.credentials != nil:
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(config.credentials))
+	default:
+		client.session = &sessionCredentials{}
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(client.session))
+	}
+
+	conn, err := grpc.Dial(address, append(dialOptions, config.dialOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial server: %w", err)
+	}
+
+	if client.tokenSource != nil {
+		client.tokenSource.start(context.Background(), conn)
+	}
+	client.conn = conn
+	client.laptops = pb.NewLaptopServiceClient(conn)
+	client.auth = pb.NewAuthServiceClient(conn)
+	return client, nil
+}
+
+// Conn returns the connection of the client, to call the RPCs it does not wrap with their generated clients.
+// The RPCs are authenticated like the ones of the client.
+func (client *Client) Conn() *grpc.ClientConn {
+	return client.conn
+}
+
+// Close stops the refreshes of the token, if any, and closes the connection of the client
+func (client *Client) Close() error {
+	if client.tokenSource != nil {
+		client.tokenSource.Close()
+	}
+	return client.conn.Close()
+}
+
+// Login logs the user in and returns its access token. Unless the client was given credentials or a login,
+// the token then authenticates its RPCs.
+func (client *Client) Login(ctx context.Context, username string, password string) (string, error) {
+	res, err := client.auth.Login(withLogin(ctx), &pb.LoginRequest{Username: username, Password: password})
+	if err != nil {
+		return "", err
+	}
+
+	if client.session != nil {
+		client.session.setToken(res.GetAccessToken())
+	}
+	return res.GetAccessToken(), nil
+}
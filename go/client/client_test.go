@@ -0,0 +1,164 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/client"
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testPolicy = `
+roles:
+  admin: {}
+anonymous:
+  - /eshaanagg.pcbook.AuthService/Login
+  - /eshaanagg.pcbook.LaptopService/SearchLaptop
+rules:
+  - methods: [/eshaanagg.pcbook.LaptopService/*]
+    roles: [admin]
+`
+
+// startTestServer serves the laptop and auth services in process, with the user admin1 whose password is secret
+func startTestServer(t *testing.T, jwtManager *service.JWTManager) string {
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+
+	userStore := service.NewInMemoryUserStore()
+	require.NoError(t, service.CreateUser(userStore, "admin1", "secret", "admin", service.DefaultTenantID))
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, nil)
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	pb.RegisterAuthServiceServer(grpcServer, service.NewAuthServer(userStore, nil, nil, nil, jwtManager, nil, policy))
+	pb.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(
+		service.NewInMemoryLaptopStore(),
+		service.NewDiskImageStore(t.TempDir()),
+		service.NewInMemoryRatingStore(),
+		service.DefaultMaxImageSize,
+		policy,
+	))
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	return listener.Addr().String()
+}
+
+func newTestClient(t *testing.T, address string, opts ...client.Option) *client.Client {
+	pcbook, err := client.New(address, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { pcbook.Close() })
+	return pcbook
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	address := startTestServer(t, service.NewJWTManager("secret", time.Minute))
+	pcbook := newTestClient(t, address, client.WithChunkSize(1024))
+
+	_, err := pcbook.CreateLaptop(ctx, sample.NewLaptop())
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = pcbook.Login(ctx, "admin1", "wrong")
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	token, err := pcbook.Login(ctx, "admin1", "secret")
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	laptops := []*pb.Laptop{sample.NewLaptop(), sample.NewLaptop(), sample.NewLaptop()}
+	for _, laptop := range laptops {
+		id, err := pcbook.CreateLaptop(ctx, laptop)
+		require.NoError(t, err)
+		require.Equal(t, laptop.GetId(), id)
+	}
+
+	found := map[string]bool{}
+	iterator := pcbook.SearchLaptop(ctx, &pb.Filter{MaxPriceUsd: 100000})
+	for iterator.Next() {
+		found[iterator.Laptop().GetId()] = true
+	}
+	require.NoError(t, iterator.Err())
+	require.Len(t, found, len(laptops))
+
+	// Closing the iterator stops the search early
+	iterator = pcbook.SearchLaptop(ctx, &pb.Filter{MaxPriceUsd: 100000})
+	require.True(t, iterator.Next())
+	iterator.Close()
+	require.False(t, iterator.Next())
+	require.NoError(t, iterator.Err())
+
+	image := bytes.Repeat([]byte{0xff}, 2500)
+	var progress []int64
+	uploadRes, err := pcbook.UploadImage(ctx, laptops[0].GetId(), ".jpg", bytes.NewReader(image), func(sent int64) {
+		progress = append(progress, sent)
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(image)), uploadRes.GetSize())
+	require.Equal(t, []int64{1024, 2048, 2500}, progress)
+
+	_, err = pcbook.UploadImage(ctx, "unknown", ".jpg", bytes.NewReader(image), nil)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Contains(t, err.Error(), "unknown")
+
+	// Another client can reuse the token of the login
+	rater := newTestClient(t, address, client.WithCredentials(client.Token(token)))
+	ratings := []*pb.RateLaptopRequest{
+		{LaptopId: laptops[0].GetId(), Score: 8},
+		{LaptopId: laptops[1].GetId(), Score: 6},
+		{LaptopId: laptops[0].GetId(), Score: 10},
+	}
+	rateRes, err := rater.RateLaptops(ctx, ratings)
+	require.NoError(t, err)
+	require.Len(t, rateRes, len(ratings))
+	require.Equal(t, uint32(2), rateRes[2].GetRatedCount())
+	require.Equal(t, 9.0, rateRes[2].GetAverageScore())
+
+	// A client holding an expired token can still log in
+	expired, err := service.NewJWTManager("secret", -time.Minute).Generate(&service.User{Username: "admin1", Role: "admin", TenantID: service.DefaultTenantID})
+	require.NoError(t, err)
+	stale := newTestClient(t, address, client.WithCredentials(client.Token(expired)))
+	_, err = stale.CreateLaptop(ctx, sample.NewLaptop())
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = stale.Login(ctx, "admin1", "secret")
+	require.NoError(t, err)
+
+	// The responses received before an error are returned along with it
+	rateRes, err = rater.RateLaptops(ctx, []*pb.RateLaptopRequest{
+		{LaptopId: laptops[1].GetId(), Score: 4},
+		{LaptopId: "unknown", Score: 4},
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Len(t, rateRes, 1)
+}
+
+func TestClientValidatesLaptop(t *testing.T) {
+	t.Parallel()
+
+	// No RPC is sent for an invalid laptop, so no server is needed
+	sent := 0
+	counter := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		sent++
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	pcbook := newTestClient(t, "localhost:1", client.WithDialOptions(grpc.WithChainUnaryInterceptor(counter)))
+
+	laptop := sample.NewLaptop()
+	laptop.Brand = ""
+	laptop.Cpu = nil
+	_, err := pcbook.CreateLaptop(context.Background(), laptop)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Contains(t, err.Error(), "brand")
+	require.Zero(t, sent)
+}
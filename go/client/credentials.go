@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// The metadata keys of the credentials checked by the auth interceptor of the server
+const (
+	authorizationKey = "authorization"
+	apiKeyKey        = "x-api-key"
+)
+
+// metadataCredentials send fixed metadata with every RPC but Login, as the server rejects
+// the credentials that expired even on the RPCs allowed anonymously
+type metadataCredentials map[string]string
+
+func (creds metadataCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if isLogin(ctx) {
+		return nil, nil
+	}
+	return creds, nil
+}
+
+// RequireTransportSecurity is false, as the server may run without TLS in development
+func (creds metadataCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Token authenticates the RPCs with an access token, such as one cached from an earlier Login
+func Token(accessToken string) credentials.PerRPCCredentials {
+	return metadataCredentials{authorizationKey: accessToken}
+}
+
+// APIKey authenticates the RPCs with an API key
+func APIKey(apiKey string) credentials.PerRPCCredentials {
+	return metadataCredentials{apiKeyKey: apiKey}
+}
+
+// sessionCredentials send the token of the last Login, if any
+type sessionCredentials struct {
+	mutex sync.RWMutex
+	token string
+}
+
+func (session *sessionCredentials) setToken(token string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.token = token
+}
+
+func (session *sessionCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	// The RPCs allowed anonymously are sent without credentials until then, and Login always is,
+	// as the server rejects the expired token of an earlier session
+	if session.token == "" || isLogin(ctx) {
+		return nil, nil
+	}
+	return map[string]string{authorizationKey: session.token}, nil
+}
+
+func (session *sessionCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// loginContextKey marks the context of the Login RPCs, which are sent without the session token
+type loginContextKey struct{}
+
+func withLogin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loginContextKey{}, true)
+}
+
+func isLogin(ctx context.Context) bool {
+	login, _ := ctx.Value(loginContextKey{}).(bool)
+	return login
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/validation"
+)
+
+// CreateLaptop creates the laptop and returns its ID, which the server generates if the laptop has none.
+// An invalid laptop is not sent: the InvalidArgument status error of the validation lists every invalid field.
+func (client *Client) CreateLaptop(ctx context.Context, laptop *pb.Laptop) (string, error) {
+	err := validation.ValidateLaptop(laptop)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := client.laptops.CreateLaptop(ctx, &pb.CreateLaptopRequest{Laptop: laptop})
+	if err != nil {
+		return "", err
+	}
+	return res.GetId(), nil
+}
+
+// LaptopIterator iterates over the laptops found by SearchLaptop:
+//
+//	laptops := client.SearchLaptop(ctx, filter)
+//	defer laptops.Close()
+//	for laptops.Next() {
+//		fmt.Println(laptops.Laptop().GetId())
+//	}
+//	if err := laptops.Err(); err != nil {
+//		...
+//	}
+type LaptopIterator struct {
+	stream pb.LaptopService_SearchLaptopClient
+	cancel context.CancelFunc
+	laptop *pb.Laptop
+	err    error
+	done   bool
+}
+
+// SearchLaptop searches the laptops matching the filter, which are received as the iterator advances
+func (client *Client) SearchLaptop(ctx context.Context, filter *pb.Filter) *LaptopIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.laptops.SearchLaptop(ctx, &pb.SearchLaptopRequest{Filter: filter})
+	if err != nil {
+		cancel()
+		return &LaptopIterator{cancel: cancel, err: err, done: true}
+	}
+	return &LaptopIterator{stream: stream, cancel: cancel}
+}
+
+// Next receives the next laptop, and returns false once the search ends or fails
+func (iterator *LaptopIterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+
+	res, err := iterator.stream.Recv()
+	if err != nil {
+		if err != io.EOF {
+			iterator.err = err
+		}
+		iterator.laptop = nil
+		iterator.Close()
+		return false
+	}
+	iterator.laptop = res.GetLaptop()
+	return true
+}
+
+// Laptop returns the laptop received by the last call to Next
+func (iterator *LaptopIterator) Laptop() *pb.Laptop {
+	return iterator.laptop
+}
+
+// Err returns the error that ended the search, if any
+func (iterator *LaptopIterator) Err() error {
+	return iterator.err
+}
+
+// Close cancels the search if it has not ended yet
+func (iterator *LaptopIterator) Close() {
+	iterator.done = true
+	iterator.cancel()
+}
+
+// UploadImage uploads the image of the laptop, whose type is the extension of its file, such as `.jpg`.
+// progress, if not nil, is called with the number of bytes sent after every chunk.
+func (client *Client) UploadImage(
+	ctx context.Context,
+	laptopID string,
+	imageType string,
+	image io.Reader,
+	progress func(sent int64),
+) (*pb.UploadImageResponse, error) {
+	// Cancelling the RPC tells the server that the image is incomplete
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.laptops.UploadImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopID, ImageType: imageType}},
+	})
+	buffer := make([]byte, client.chunkSize)
+	var sent int64
+	for err == nil {
+		n, readErr := image.Read(buffer)
+		if n > 0 {
+			err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: buffer[:n]}})
+			if err == nil {
+				sent += int64(n)
+				if progress != nil {
+					progress(sent)
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil && err == nil {
+			return nil, fmt.Errorf("cannot read the image: %w", readErr)
+		}
+	}
+	// io.EOF means that the server ended the RPC, whose status is returned by CloseAndRecv
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// RateLaptops sends the ratings over a single stream, and returns the updated rating of the laptop of each of them,
+// in the same order. The responses received before an error are returned along with it.
+func (client *Client) RateLaptops(ctx context.Context, ratings []*pb.RateLaptopRequest) ([]*pb.RateLaptopResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.laptops.RateLaptop(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ratings are sent while the responses are received, so that neither side blocks on flow control
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, rating := range ratings {
+			err := stream.Send(rating)
+			// io.EOF means that the server ended the RPC, whose status is returned by Recv
+			if err == io.EOF {
+				sendErr <- nil
+				return
+			}
+			if err != nil {
+				sendErr <- err
+				cancel()
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	responses := make([]*pb.RateLaptopResponse, 0, len(ratings))
+	var recvErr error
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			recvErr = err
+			break
+		}
+		responses = append(responses, res)
+	}
+
+	// Cancelling unblocks the sender when the server ends the RPC early
+	cancel()
+	if err := <-sendErr; err != nil {
+		return responses, err
+	}
+	return responses, recvErr
+}
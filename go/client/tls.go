@@ -0,0 +1,45 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// LoadTLSCredentials returns TLS credentials if a CA bundle is given, and insecure credentials otherwise.
+// The client certificate is only sent if both its certificate and key files are given.
+func LoadTLSCredentials(caFile string, certFile string, keyFile string, serverName string) (credentials.TransportCredentials, error) {
+	if caFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in the CA bundle %s", caFile)
+	}
+
+	config := &tls.Config{
+		RootCAs:    pool,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if certFile != "" && keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return credentials.NewTLS(config), nil
+}
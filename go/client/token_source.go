@@ -0,0 +1,297 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// loginMethod is called without a token, as the token source calls it to get one
+const loginMethod = "/eshaanagg.pcbook.AuthService/Login"
+
+const (
+	// refreshAhead is the fraction of the lifetime of a token that is left when the token is refreshed
+	refreshAhead = 5
+	// refreshRetryDelay is the delay before retrying a failed refresh, while the token is still valid
+	refreshRetryDelay = 5 * time.Second
+	// refreshTimeout bounds the logins of the background refreshes
+	refreshTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned for the RPCs of a closed token source
+var ErrClosed = errors.New("the token source is closed")
+
+// TokenSource logs a user in and keeps its access token fresh, logging in again ahead of the `exp` claim of the token.
+// Its interceptors add the token to the RPCs, and log in again when the server rejects the token, such as after
+// its signing key was rotated: unary RPCs are then retried once, while the streams, which cannot be replayed,
+// fail with the Unauthenticated error and the next RPC gets a new token. It is safe for concurrent use.
+type TokenSource struct {
+	username string
+	password string
+	auth     pb.AuthServiceClient
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+	// refreshAt is zero if the token is refreshed on demand only, as when it has no expiry
+	refreshAt time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// updated wakes the refresher up when the token changes
+	updated chan struct{}
+	done    chan struct{}
+}
+
+// NewTokenSource returns a token source logging the user in through the connection, which may be a connection
+// without the interceptors of the source. The user logs in with the first RPC, and the token is refreshed
+// in the background until the context is done or the source is closed.
+func NewTokenSource(ctx context.Context, conn grpc.ClientConnInterface, username string, password string) *TokenSource {
+	source := newTokenSource(username, password)
+	source.start(ctx, conn)
+	return source
+}
+
+// newTokenSource returns a token source whose interceptors can be given to the connection it is started with
+func newTokenSource(username string, password string) *TokenSource {
+	return &TokenSource{
+		username: username,
+		password: password,
+		updated:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (source *TokenSource) start(ctx context.Context, conn grpc.ClientConnInterface) {
+	source.auth = pb.NewAuthServiceClient(conn)
+	source.ctx, source.cancel = context.WithCancel(ctx)
+	go source.refresh()
+}
+
+// Close stops the background refreshes, after which the RPCs fail with ErrClosed
+func (source *TokenSource) Close() {
+	source.cancel()
+	<-source.done
+}
+
+// Token returns the current access token, logging the user in if there is none or if it expired
+func (source *TokenSource) Token(ctx context.Context) (string, error) {
+	if source.ctx.Err() != nil {
+		return "", ErrClosed
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if source.token != "" && (source.expiresAt.IsZero() || time.Now().Before(source.expiresAt)) {
+		return source.token, nil
+	}
+	return source.loginLocked(ctx)
+}
+
+// renew returns a new token after the server rejected the stale one, unless another RPC already renewed it
+func (source *TokenSource) renew(ctx context.Context, stale string) (string, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if source.token != "" && source.token != stale {
+		return source.token, nil
+	}
+	return source.loginLocked(ctx)
+}
+
+// invalidate forgets the token if it is the current one, so that the next RPC logs in again
+func (source *TokenSource) invalidate(stale string) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if source.token == stale {
+		source.token = ""
+	}
+}
+
+// loginLocked logs the user in while holding the mutex, so that concurrent RPCs wait for a single login
+func (source *TokenSource) loginLocked(ctx context.Context) (string, error) {
+	res, err := source.auth.Login(ctx, &pb.LoginRequest{Username: source.username, Password: source.password})
+	if err != nil {
+		return "", err
+	}
+	source.setTokenLocked(res.GetAccessToken())
+	return source.token, nil
+}
+
+// setTokenLocked stores the token and schedules its refresh from its `exp` claim, which is not verified by the client
+func (source *TokenSource) setTokenLocked(token string) {
+	now := time.Now()
+	source.token = token
+	source.expiresAt = time.Time{}
+	source.refreshAt = time.Time{}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err == nil {
+		if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+			source.expiresAt = expiresAt.Time
+			source.refreshAt = now.Add(expiresAt.Sub(now) * (refreshAhead - 1) / refreshAhead)
+		}
+	}
+
+	select {
+	case source.updated <- struct{}{}:
+	default:
+	}
+}
+
+// refresh logs in again when the refresh of the token is due, until the source is closed
+func (source *TokenSource) refresh() {
+	defer close(source.done)
+
+	for {
+		source.mutex.Lock()
+		refreshAt := source.refreshAt
+		source.mutex.Unlock()
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !refreshAt.IsZero() {
+			timer = time.NewTimer(time.Until(refreshAt))
+			due = timer.C
+		}
+
+		select {
+		case <-source.ctx.Done():
+		case <-source.updated:
+		case <-due:
+			source.refreshNow()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if source.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// refreshNow logs in without holding the mutex, so that the RPCs keep using the current token meanwhile.
+// The login carries the current token, for the server to audit it as a refresh of the session.
+func (source *TokenSource) refreshNow() {
+	source.mutex.Lock()
+	current := source.token
+	source.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(source.ctx, refreshTimeout)
+	defer cancel()
+	req := &pb.LoginRequest{Username: source.username, Password: source.password}
+	loginCtx := ctx
+	if current != "" {
+		loginCtx = withToken(ctx, current)
+	}
+	res, err := source.auth.Login(loginCtx, req)
+	if status.Code(err) == codes.Unauthenticated && current != "" {
+		// The server rejected the current token, such as after its signing key was rotated
+		res, err = source.auth.Login(ctx, req)
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	if err == nil {
+		source.setTokenLocked(res.GetAccessToken())
+		return
+	}
+	if source.ctx.Err() != nil {
+		return
+	}
+
+	slog.Warn("Cannot refresh the access token", "username", source.username, "error", err)
+	// Once the token expires, the next RPC logs in on demand instead
+	source.refreshAt = time.Time{}
+	if retryAt := time.Now().Add(refreshRetryDelay); retryAt.Before(source.expiresAt) {
+		source.refreshAt = retryAt
+	}
+}
+
+// withToken returns the context of an RPC carrying the token, which replaces the one of an earlier attempt
+func withToken(ctx context.Context, token string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(authorizationKey, token)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// Unary adds the token to the unary RPCs, and retries them once with a new token if the server rejects it
+func (source *TokenSource) Unary() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if method == loginMethod {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		token, err := source.Token(ctx)
+		if err != nil {
+			return err
+		}
+		err = invoker(withToken(ctx, token), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		token, renewErr := source.renew(ctx, token)
+		if renewErr != nil {
+			return err
+		}
+		return invoker(withToken(ctx, token), method, req, reply, cc, opts...)
+	}
+}
+
+// Stream adds the token to the streaming RPCs, and forgets it if the server rejects it
+func (source *TokenSource) Stream() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		token, err := source.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(withToken(ctx, token), desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenStream{ClientStream: stream, source: source, token: token}, nil
+	}
+}
+
+// tokenStream forgets its token when the server rejects it, the status of the RPC being received with a message
+type tokenStream struct {
+	grpc.ClientStream
+	source *TokenSource
+	token  string
+}
+
+func (stream *tokenStream) RecvMsg(m interface{}) error {
+	err := stream.ClientStream.RecvMsg(m)
+	if status.Code(err) == codes.Unauthenticated {
+		stream.source.invalidate(stream.token)
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/client"
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newTestSigningKey(t *testing.T, id string) *service.SigningKey {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &service.SigningKey{
+		ID:         id,
+		Method:     jwt.SigningMethodEdDSA,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		ActiveFrom: time.Now(),
+	}
+}
+
+// fakeAuthServer signs the tokens of every login, without the cost of checking a password
+type fakeAuthServer struct {
+	pb.UnimplementedAuthServiceServer
+	jwtManager *service.JWTManager
+	logins     atomic.Int32
+}
+
+func (server *fakeAuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	server.logins.Add(1)
+	token, err := server.jwtManager.Generate(&service.User{Username: req.GetUsername(), Role: "admin"})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LoginResponse{AccessToken: token}, nil
+}
+
+func TestTokenSourceRefreshesAheadOfExpiry(t *testing.T) {
+	t.Parallel()
+
+	// The tokens expire on a whole second, within 2 seconds
+	authServer := &fakeAuthServer{jwtManager: service.NewJWTManager("secret", 2*time.Second)}
+	grpcServer := grpc.NewServer()
+	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	source := client.NewTokenSource(ctx, conn, "admin1", "secret")
+	t.Cleanup(source.Close)
+
+	// Concurrent RPCs wait for a single login
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	errs := make([]error, len(tokens))
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = source.Token(ctx)
+		}(i)
+	}
+	wg.Wait()
+	first := tokens[0]
+	require.NotEmpty(t, first)
+	for i, token := range tokens {
+		require.NoError(t, errs[i])
+		require.Equal(t, first, token)
+	}
+	require.Equal(t, int32(1), authServer.logins.Load())
+
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(first, claims)
+	require.NoError(t, err)
+	exp, err := claims.GetExpirationTime()
+	require.NoError(t, err)
+
+	// The token is replaced in the background before it expires
+	require.Eventually(t, func() bool {
+		token, err := source.Token(ctx)
+		return err == nil && token != first
+	}, 3*time.Second, 20*time.Millisecond)
+	require.True(t, time.Now().Before(exp.Time))
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, err := source.Token(context.Background())
+		return err == client.ErrClosed
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTokenSourceRenewsRejectedToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	jwtManager, err := service.NewJWTManagerWithKeys(time.Minute, newTestSigningKey(t, "old"))
+	require.NoError(t, err)
+	address := startTestServer(t, jwtManager)
+	pcbook := newTestClient(t, address, client.WithLogin("admin1", "secret"))
+
+	_, err = pcbook.CreateLaptop(ctx, sample.NewLaptop())
+	require.NoError(t, err)
+
+	// Rotating the signing key rejects the cached token, so the concurrent RPCs log in again and are retried
+	rotate := func(from string, to string) {
+		require.NoError(t, jwtManager.AddKey(newTestSigningKey(t, to)))
+		jwtManager.RemoveKey(from)
+	}
+	rotate("old", "new")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pcbook.CreateLaptop(ctx, sample.NewLaptop())
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// A stream cannot be replayed, but the next one gets a new token
+	laptop := sample.NewLaptop()
+	_, err = pcbook.CreateLaptop(ctx, laptop)
+	require.NoError(t, err)
+	rotate("new", "newer")
+	image := bytes.Repeat([]byte{0xff}, 1024)
+	_, err = pcbook.UploadImage(ctx, laptop.GetId(), ".jpg", bytes.NewReader(image), nil)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = pcbook.UploadImage(ctx, laptop.GetId(), ".jpg", bytes.NewReader(image), nil)
+	require.NoError(t, err)
+}
+
+func TestTokenSourceRefreshIsAudited(t *testing.T) {
+	t.Parallel()
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+	auditLog, err := service.NewFileAuditLog(t.TempDir(), 1<<20, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+
+	// The tokens expire on a whole second, within 2 seconds
+	jwtManager := service.NewJWTManager("secret", 2*time.Second)
+	userStore := service.NewInMemoryUserStore()
+	require.NoError(t, service.CreateUser(userStore, "admin1", "secret", "admin", service.DefaultTenantID))
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, auditLog)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()))
+	pb.RegisterAuthServiceServer(grpcServer, service.NewAuthServer(userStore, nil, nil, nil, jwtManager, nil, policy))
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	source := client.NewTokenSource(context.Background(), newTestClient(t, listener.Addr().String()).Conn(), "admin1", "secret")
+	t.Cleanup(source.Close)
+	_, err = source.Token(context.Background())
+	require.NoError(t, err)
+
+	// The background refresh is recorded as such, and the first login as a new session
+	require.Eventually(t, func() bool {
+		events, err := auditLog.Query(service.AuditFilter{Username: "admin1"})
+		require.NoError(t, err)
+		return len(events) >= 2
+	}, 5*time.Second, 50*time.Millisecond)
+	events, err := auditLog.Query(service.AuditFilter{Username: "admin1"})
+	require.NoError(t, err)
+	require.Equal(t, service.AuditLoginSuccess, events[0].Type)
+	require.Equal(t, service.AuditTokenRefresh, events[1].Type)
+}
@@ -1,116 +0,0 @@
-package main
-
-import (
-	"context"
-	"log"
-	"time"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
-)
-
-type AuthInterceptor struct {
-	authClient *AuthClient
-	// A map which lets us know which methods require authentication
-	authMethods map[string]bool
-	accessToken string
-}
-
-func NewAuthInterceptor(
-	authClient *AuthClient,
-	authMethods map[string]bool,
-	refreshDuration time.Duration,
-) (*AuthInterceptor, error) {
-	interceptor := &AuthInterceptor{
-		authClient:  authClient,
-		authMethods: authMethods,
-	}
-
-	err := interceptor.scheduleRefreshToken(refreshDuration)
-	if err != nil {
-		return nil, err
-	}
-
-	return interceptor, nil
-}
-
-// Unary returns a client interceptor to authenticate unary RPC
-func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
-	return func(
-		ctx context.Context,
-		method string,
-		req, reply interface{},
-		cc *grpc.ClientConn,
-		invoker grpc.UnaryInvoker,
-		opts ...grpc.CallOption,
-	) error {
-		log.Printf("--> Unary Interceptor: %s", method)
-
-		if interceptor.authMethods[method] {
-			log.Printf("Attaching Authorization header for the method %v", method)
-			return invoker(interceptor.attachToken(ctx), method, req, reply, cc, opts...)
-		}
-
-		return invoker(ctx, method, req, reply, cc, opts...)
-	}
-}
-
-// Stream returns a client interceptor to authenticate stream RPC
-func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
-	return func(
-		ctx context.Context,
-		desc *grpc.StreamDesc,
-		cc *grpc.ClientConn,
-		method string,
-		streamer grpc.Streamer,
-		opts ...grpc.CallOption,
-	) (grpc.ClientStream, error) {
-		log.Printf("--> Stream interceptor: %s", method)
-
-		if interceptor.authMethods[method] {
-			return streamer(interceptor.attachToken(ctx), desc, cc, method, opts...)
-		}
-
-		return streamer(ctx, desc, cc, method, opts...)
-	}
-}
-
-func (interceptor *AuthInterceptor) attachToken(ctx context.Context) context.Context {
-	return metadata.AppendToOutgoingContext(ctx, "authorization", interceptor.accessToken)
-}
-
-// Launch a seperate goroutine which infinetely refreshes the login token
-func (interceptor *AuthInterceptor) scheduleRefreshToken(refreshDuration time.Duration) error {
-	err := interceptor.refreshToken()
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		wait := refreshDuration
-		for {
-			time.Sleep(wait)
-			err := interceptor.refreshToken()
-			if err != nil {
-				wait = time.Second
-			} else {
-				wait = refreshDuration
-			}
-		}
-	}()
-
-	return nil
-}
-
-// Used to login and get the refreshed access token
-func (interceptor *AuthInterceptor) refreshToken() error {
-	accessToken, err := interceptor.authClient.Login()
-	if err != nil {
-		return err
-	}
-
-	interceptor.accessToken = accessToken
-	log.Printf("Token refreshed: %v", accessToken)
-
-	return nil
-}
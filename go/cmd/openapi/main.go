@@ -0,0 +1,25 @@
+// Command openapi writes the OpenAPI document of the HTTP gateway, generated from the proto messages
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/eshaanagg/pcbook/go/openapi"
+)
+
+func main() {
+	output := flag.String("output", "openapi/openapi.json", "the file the document is written to")
+	flag.Parse()
+
+	spec, err := openapi.Generate()
+	if err != nil {
+		log.Fatalf("cannot generate the OpenAPI document: %v", err)
+	}
+
+	err = os.WriteFile(*output, spec, 0644)
+	if err != nil {
+		log.Fatalf("cannot write the OpenAPI document: %v", err)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// passwordEnv holds the password of the user, so that it does not show up in the process list
+	passwordEnv = "PCBOOK_PASSWORD"
+	// newPasswordEnv holds the password of a created user
+	newPasswordEnv = "PCBOOK_NEW_PASSWORD"
+)
+
+var laptopColumns = []column[*pb.Laptop]{
+	{"ID", (*pb.Laptop).GetId},
+	{"BRAND", (*pb.Laptop).GetBrand},
+	{"NAME", (*pb.Laptop).GetName},
+	{"CORES", func(laptop *pb.Laptop) string { return strconv.Itoa(int(laptop.GetCpu().GetNumberCores())) }},
+	{"MIN GHZ", func(laptop *pb.Laptop) string { return strconv.FormatFloat(laptop.GetCpu().GetMinGhz(), 'f', 2, 64) }},
+	{"RAM", func(laptop *pb.Laptop) string { return formatMemory(laptop.GetRam()) }},
+	{"PRICE USD", func(laptop *pb.Laptop) string { return strconv.FormatFloat(laptop.GetPriceUsd(), 'f', 2, 64) }},
+}
+
+// readSecret returns the value of the environment variable, or else the first line of stdin
+func (cli *cli) readSecret(env string, prompt string) (string, error) {
+	if secret := os.Getenv(env); secret != "" {
+		return secret, nil
+	}
+
+	if file, ok := cli.stdin.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(cli.stderr, prompt)
+		}
+	}
+	line, err := bufio.NewReader(cli.stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("cannot read the password from $%s or stdin: %w", env, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (cli *cli) login(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	username := flags.String("username", "admin", "the user to log in as")
+	if _, err := cli.parseFlags(flags, "login [--username name]", args, 0); err != nil {
+		return err
+	}
+
+	password, err := cli.readSecret(passwordEnv, "Password: ")
+	if err != nil {
+		return err
+	}
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connectAnonymously()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	accessToken, err := pcbook.Login(ctx, *username, password)
+	if err != nil {
+		return err
+	}
+
+	cache, err := loadCredentials(cli.options.configDir)
+	if err != nil {
+		return err
+	}
+	cache.Servers[cli.options.address] = cachedToken{Username: *username, AccessToken: accessToken}
+	err = cache.save(cli.options.configDir)
+	if err != nil {
+		return err
+	}
+
+	if printer.format == outputTable {
+		fmt.Fprintf(cli.stdout, "Logged in to %s as %s\n", cli.options.address, *username)
+		return nil
+	}
+	return printMessage(printer, &pb.LoginResponse{AccessToken: accessToken}, nil)
+}
+
+func (cli *cli) logout(args []string) error {
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	if _, err := cli.parseFlags(flags, "logout", args, 0); err != nil {
+		return err
+	}
+
+	cache, err := loadCredentials(cli.options.configDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := cache.Servers[cli.options.address]; !ok {
+		return nil
+	}
+	delete(cache.Servers, cli.options.address)
+	return cache.save(cli.options.configDir)
+}
+
+func (cli *cli) createLaptop(args []string) error {
+	flags := flag.NewFlagSet("laptop create", flag.ContinueOnError)
+	filename := flags.String("f", "", "the JSON file of the laptop, - for stdin")
+	if _, err := cli.parseFlags(flags, "laptop create -f laptop.json", args, 0); err != nil {
+		return err
+	}
+	if *filename == "" {
+		flags.Usage()
+		return usageErrorf("the laptop file is required")
+	}
+
+	var data []byte
+	var err error
+	if *filename == "-" {
+		data, err = io.ReadAll(cli.stdin)
+	} else {
+		data, err = os.ReadFile(*filename)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read the laptop: %w", err)
+	}
+
+	laptop := &pb.Laptop{}
+	err = protojson.Unmarshal(data, laptop)
+	if err != nil {
+		return fmt.Errorf("cannot parse the laptop: %w", err)
+	}
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	id, err := pcbook.CreateLaptop(ctx, laptop)
+	if err != nil {
+		return err
+	}
+	return printMessage(printer, &pb.CreateLaptopResponse{Id: id}, []column[*pb.CreateLaptopResponse]{{"ID", (*pb.CreateLaptopResponse).GetId}})
+}
+
+func (cli *cli) searchLaptop(args []string) error {
+	flags := flag.NewFlagSet("laptop search", flag.ContinueOnError)
+	maxPrice := flags.Float64("max-price", 0, "the maximum price in USD, unlimited if 0")
+	minCores := flags.Uint("min-cores", 0, "the minimum number of CPU cores")
+	minGhz := flags.Float64("min-ghz", 0, "the minimum CPU frequency in GHz")
+	minRAM := flags.String("min-ram", "", "the minimum RAM, such as 16GB or 512MB")
+	if _, err := cli.parseFlags(flags, "laptop search [flags]", args, 0); err != nil {
+		return err
+	}
+
+	filter := &pb.Filter{MaxPriceUsd: *maxPrice, MinCpuCores: uint32(*minCores), MinCpuGhz: *minGhz}
+	if *maxPrice == 0 {
+		// The server compares the price with the maximum, so an unlimited search has the largest one
+		filter.MaxPriceUsd = math.MaxFloat64
+	}
+	if *minRAM != "" {
+		memory, err := parseMemory(*minRAM)
+		if err != nil {
+			return usageErrorf("invalid --min-ram: %v", err)
+		}
+		filter.MinRam = memory
+	}
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	iterator := pcbook.SearchLaptop(ctx, filter)
+	defer iterator.Close()
+	var laptops []*pb.Laptop
+	for iterator.Next() {
+		laptops = append(laptops, iterator.Laptop())
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	return printList(printer, laptops, laptopColumns)
+}
+
+func (cli *cli) uploadImage(args []string) error {
+	flags := flag.NewFlagSet("image upload", flag.ContinueOnError)
+	args, err := cli.parseFlags(flags, "image upload <laptop-id> <file>", args, 2)
+	if err != nil {
+		return err
+	}
+	laptopID, imagePath := args[0], args[1]
+
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return fmt.Errorf("cannot open the image: %w", err)
+	}
+	defer file.Close()
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	res, err := pcbook.UploadImage(ctx, laptopID, filepath.Ext(imagePath), file, nil)
+	if err != nil {
+		return err
+	}
+	return printMessage(printer, res, []column[*pb.UploadImageResponse]{
+		{"ID", (*pb.UploadImageResponse).GetId},
+		{"SIZE", func(res *pb.UploadImageResponse) string { return strconv.Itoa(int(res.GetSize())) }},
+	})
+}
+
+func (cli *cli) rateLaptop(args []string) error {
+	flags := flag.NewFlagSet("rate", flag.ContinueOnError)
+	args, err := cli.parseFlags(flags, "rate <laptop-id> <score>", args, 2)
+	if err != nil {
+		return err
+	}
+	score, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return usageErrorf("invalid score %q", args[1])
+	}
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	responses, err := pcbook.RateLaptops(ctx, []*pb.RateLaptopRequest{{LaptopId: args[0], Score: score}})
+	if err != nil {
+		return err
+	}
+	res := responses[0]
+
+	return printMessage(printer, res, []column[*pb.RateLaptopResponse]{
+		{"LAPTOP ID", (*pb.RateLaptopResponse).GetLaptopId},
+		{"RATED COUNT", func(res *pb.RateLaptopResponse) string { return strconv.Itoa(int(res.GetRatedCount())) }},
+		{"AVERAGE SCORE", func(res *pb.RateLaptopResponse) string {
+			return strconv.FormatFloat(res.GetAverageScore(), 'f', 2, 64)
+		}},
+	})
+}
+
+func (cli *cli) createUser(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	role := flags.String("role", "", "the role of the user, such as user or admin")
+	tenant := flags.String("tenant", "", "the tenant of the user, the tenant of the caller by default")
+	args, err := cli.parseFlags(flags, "user create <username> --role role [--tenant id]", args, 1)
+	if err != nil {
+		return err
+	}
+	if *role == "" {
+		flags.Usage()
+		return usageErrorf("the role is required")
+	}
+
+	password, err := cli.readSecret(newPasswordEnv, "Password of the new user: ")
+	if err != nil {
+		return err
+	}
+	printer, err := newPrinter(cli.stdout, cli.options.output)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	res, err := pb.NewAuthServiceClient(pcbook.Conn()).CreateUser(ctx, &pb.CreateUserRequest{
+		Username: args[0],
+		Password: password,
+		Role:     *role,
+		TenantId: *tenant,
+	})
+	if err != nil {
+		return err
+	}
+	return printMessage(printer, res, []column[*pb.CreateUserResponse]{
+		{"USERNAME", (*pb.CreateUserResponse).GetUsername},
+		{"TENANT", (*pb.CreateUserResponse).GetTenantId},
+	})
+}
+
+func (cli *cli) unlockUser(args []string) error {
+	flags := flag.NewFlagSet("user unlock", flag.ContinueOnError)
+	args, err := cli.parseFlags(flags, "user unlock <username>", args, 1)
+	if err != nil {
+		return err
+	}
+
+	ctx, pcbook, closeAll, err := cli.connect()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	if _, err := pb.NewAuthServiceClient(pcbook.Conn()).UnlockUser(ctx, &pb.UnlockUserRequest{Username: args[0]}); err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.stdout, "Unlocked %s\n", args[0])
+	return nil
+}
+
+// memoryUnits are the suffixes of the memory sizes, B coming last so that GB is not parsed as bytes
+var memoryUnits = []struct {
+	suffix string
+	unit   pb.Memory_Unit
+}{
+	{"bit", pb.Memory_BIT},
+	{"kb", pb.Memory_KILOBYTE},
+	{"mb", pb.Memory_MEGABYTE},
+	{"gb", pb.Memory_GIGABYTE},
+	{"tb", pb.Memory_TERABYTE},
+	{"b", pb.Memory_BTYE},
+}
+
+// parseMemory parses a memory size such as 16GB, 512mb or 8bit
+func parseMemory(text string) (*pb.Memory, error) {
+	lower := strings.ToLower(strings.TrimSpace(text))
+	for _, unit := range memoryUnits {
+		number, ok := strings.CutSuffix(lower, unit.suffix)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(number), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a size such as 16GB", text)
+		}
+		return &pb.Memory{Value: value, Unit: unit.unit}, nil
+	}
+	return nil, fmt.Errorf("%q has no unit among bit, B, KB, MB, GB and TB", text)
+}
+
+func formatMemory(memory *pb.Memory) string {
+	for _, unit := range memoryUnits {
+		if unit.unit == memory.GetUnit() {
+			return strconv.FormatUint(memory.GetValue(), 10) + strings.ToUpper(unit.suffix)
+		}
+	}
+	return strconv.FormatUint(memory.GetValue(), 10)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// credentialsFile is the file of the config directory caching the access tokens
+const credentialsFile = "credentials.json"
+
+// cachedToken is the access token of a server
+type cachedToken struct {
+	Username    string `json:"username"`
+	AccessToken string `json:"access_token"`
+}
+
+// credentialsCache holds the access token of every server logged in to, by address
+type credentialsCache struct {
+	Servers map[string]cachedToken `json:"servers"`
+}
+
+// defaultConfigDir returns $PCBOOK_CONFIG_DIR, or the pcbook directory of the user configuration directory
+func defaultConfigDir() string {
+	if dir := os.Getenv("PCBOOK_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".pcbook"
+	}
+	return filepath.Join(dir, "pcbook")
+}
+
+// loadCredentials reads the cache of the config directory, which is empty if the file does not exist yet
+func loadCredentials(configDir string) (*credentialsCache, error) {
+	cache := &credentialsCache{Servers: make(map[string]cachedToken)}
+
+	data, err := os.ReadFile(filepath.Join(configDir, credentialsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the cached credentials: %w", err)
+	}
+
+	err = json.Unmarshal(data, cache)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the cached credentials %s: %w", filepath.Join(configDir, credentialsFile), err)
+	}
+	if cache.Servers == nil {
+		cache.Servers = make(map[string]cachedToken)
+	}
+	return cache, nil
+}
+
+// save writes the cache, readable by the user only, replacing the previous file atomically
+func (cache *credentialsCache) save(configDir string) error {
+	err := os.MkdirAll(configDir, 0700)
+	if err != nil {
+		return fmt.Errorf("cannot create the config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(configDir, credentialsFile+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write the cached credentials: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(configDir, credentialsFile))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write the cached credentials: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit statuses of the commands
+const (
+	exitOK = 0
+	// exitError is the status of the errors that are not RPC errors, such as an unreadable file
+	exitError = 1
+	exitUsage = 2
+)
+
+// exitCodes maps the gRPC status codes of the failed RPCs to the exit statuses, grouped by what the caller can do
+var exitCodes = map[codes.Code]int{
+	codes.OK:                 exitOK,
+	codes.InvalidArgument:    3,
+	codes.FailedPrecondition: 3,
+	codes.OutOfRange:         3,
+	codes.NotFound:           4,
+	codes.AlreadyExists:      5,
+	codes.Aborted:            5,
+	codes.Unauthenticated:    6,
+	codes.PermissionDenied:   7,
+	codes.ResourceExhausted:  8,
+	codes.Canceled:           9,
+	codes.DeadlineExceeded:   9,
+	codes.Unavailable:        9,
+	codes.Unknown:            10,
+	codes.Unimplemented:      10,
+	codes.Internal:           10,
+	codes.DataLoss:           10,
+}
+
+// exitUsageHelp documents the exit statuses in the usage of the CLI
+const exitUsageHelp = `Exit statuses:
+  0   success
+  1   local error, such as an unreadable file
+  2   invalid command line
+  3   invalid argument
+  4   not found
+  5   already exists
+  6   not logged in, or the token expired: run pcbook login
+  7   permission denied
+  8   rate limited, retry later
+  9   server unavailable, timed out or cancelled, retry later
+  10  server error`
+
+// usageError is an invalid command line
+type usageError struct {
+	message string
+}
+
+func (err *usageError) Error() string {
+	return err.message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+// exitCode returns the exit status of the error of a command
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return exitError
+	}
+	if code, ok := exitCodes[st.Code()]; ok {
+		return code
+	}
+	return exitError
+}
+
+// describeError formats an RPC error with its code and the details sent by the server, one per line
+func describeError(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err.Error()
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s: %s", st.Code(), st.Message())
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				fmt.Fprintf(&builder, "\n  - %s: %s", violation.GetField(), violation.GetDescription())
+			}
+		case *errdetails.RetryInfo:
+			fmt.Fprintf(&builder, "\n  retry in %v", detail.GetRetryDelay().AsDuration())
+		case *errdetails.QuotaFailure:
+			for _, violation := range detail.GetViolations() {
+				fmt.Fprintf(&builder, "\n  quota exceeded for %s: %s", violation.GetSubject(), violation.GetDescription())
+			}
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,286 @@
+// Command pcbook is the command line client of the pcbook server
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/client"
+	"github.com/eshaanagg/pcbook/go/service"
+	"google.golang.org/grpc"
+)
+
+// options are the flags shared by every command
+type options struct {
+	address       string
+	configDir     string
+	output        string
+	apiKey        string
+	timeout       time.Duration
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+	traceExporter string
+	traceTarget   string
+	traceInsecure bool
+}
+
+func (opts *options) register(flags *flag.FlagSet) {
+	address := os.Getenv("PCBOOK_ADDRESS")
+	if address == "" {
+		address = "localhost:8080"
+	}
+
+	flags.StringVar(&opts.address, "address", address, "the host:port of the server, or $PCBOOK_ADDRESS")
+	flags.StringVar(&opts.configDir, "config-dir", defaultConfigDir(), "the directory caching the access tokens, or $PCBOOK_CONFIG_DIR")
+	flags.StringVar(&opts.output, "o", outputTable, "the output format: table, json or yaml")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("PCBOOK_API_KEY"), "an API key used instead of the cached token, or $PCBOOK_API_KEY")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "the timeout of the command")
+	flags.StringVar(&opts.tlsCA, "tls-ca", "", "the PEM bundle of CAs used to verify the server, TLS is disabled if empty")
+	flags.StringVar(&opts.tlsCert, "tls-cert", "", "the PEM client certificate for mutual TLS")
+	flags.StringVar(&opts.tlsKey, "tls-key", "", "the PEM private key of the client certificate")
+	flags.StringVar(&opts.tlsServerName, "tls-server-name", "", "the name to verify the server certificate against, defaults to the host of the address")
+	flags.StringVar(&opts.traceExporter, "trace-exporter", service.TraceExporterNone, "where the spans are exported: none, stdout, file or otlp")
+	flags.StringVar(&opts.traceTarget, "trace-target", "", "the file of the file exporter, or the host:port of the collector of the otlp exporter")
+	flags.BoolVar(&opts.traceInsecure, "trace-insecure", false, "disable TLS towards the collector of the otlp exporter")
+}
+
+// cli runs the commands with their input and output streams
+type cli struct {
+	options options
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// command is a command, or a group of subcommands, of the CLI
+type command struct {
+	usage       string
+	description string
+	run         func(cli *cli, args []string) error
+	subcommands map[string]*command
+}
+
+var commands = map[string]*command{
+	"login": {
+		usage:       "login [--username name]",
+		description: "log in with the password of $PCBOOK_PASSWORD or stdin, and cache the token",
+		run:         (*cli).login,
+	},
+	"logout": {
+		usage:       "logout",
+		description: "remove the cached token of the server",
+		run:         (*cli).logout,
+	},
+	"laptop": {
+		description: "manage the laptops",
+		subcommands: map[string]*command{
+			"create": {
+				usage:       "laptop create -f laptop.json",
+				description: "create a laptop from a JSON file, or stdin with -f -",
+				run:         (*cli).createLaptop,
+			},
+			"search": {
+				usage:       "laptop search [--max-price usd] [--min-cores n] [--min-ghz ghz] [--min-ram 16GB]",
+				description: "search the laptops matching the filter",
+				run:         (*cli).searchLaptop,
+			},
+		},
+	},
+	"image": {
+		description: "manage the laptop images",
+		subcommands: map[string]*command{
+			"upload": {
+				usage:       "image upload <laptop-id> <file>",
+				description: "upload an image of a laptop",
+				run:         (*cli).uploadImage,
+			},
+		},
+	},
+	"rate": {
+		usage:       "rate <laptop-id> <score>",
+		description: "rate a laptop from 1 to 10",
+		run:         (*cli).rateLaptop,
+	},
+	"user": {
+		description: "manage the users",
+		subcommands: map[string]*command{
+			"create": {
+				usage:       "user create <username> --role role [--tenant id]",
+				description: "create a user with the password of $PCBOOK_NEW_PASSWORD or stdin",
+				run:         (*cli).createUser,
+			},
+			"unlock": {
+				usage:       "user unlock <username>",
+				description: "unlock a user locked out after failed logins",
+				run:         (*cli).unlockUser,
+			},
+		},
+	},
+}
+
+// run runs the command of the arguments
+func (cli *cli) run(args []string) error {
+	cmd := &command{subcommands: commands}
+	var path []string
+	for cmd.subcommands != nil {
+		if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			cli.printUsage(path, cmd)
+			if len(args) == 0 {
+				return usageErrorf("missing command")
+			}
+			return nil
+		}
+
+		subcommand, ok := cmd.subcommands[args[0]]
+		if !ok {
+			cli.printUsage(path, cmd)
+			return usageErrorf("unknown command %q", strings.Join(append(path, args[0]), " "))
+		}
+		path = append(path, args[0])
+		cmd, args = subcommand, args[1:]
+	}
+
+	return cmd.run(cli, args)
+}
+
+func (cli *cli) printUsage(path []string, cmd *command) {
+	fmt.Fprintf(cli.stderr, "Usage: %s <command> [flags]\n\nCommands:\n", strings.Join(append([]string{"pcbook"}, path...), " "))
+
+	var lines []string
+	var collect func(cmd *command)
+	collect = func(cmd *command) {
+		if cmd.run != nil {
+			lines = append(lines, fmt.Sprintf("  %-60s %s", cmd.usage, cmd.description))
+		}
+		for _, subcommand := range cmd.subcommands {
+			collect(subcommand)
+		}
+	}
+	collect(cmd)
+	sort.Strings(lines)
+
+	fmt.Fprintf(cli.stderr, "%s\n\nRun a command with -h for its flags, such as `pcbook laptop search -h`.\n\n%s\n", strings.Join(lines, "\n"), exitUsageHelp)
+}
+
+// parseFlags parses the flags of a command along with the shared options, and checks the number of arguments.
+// Unlike the flag package, the flags may follow the arguments, as in `pcbook rate <id> 8 -o json`.
+func (cli *cli) parseFlags(flags *flag.FlagSet, usage string, args []string, argCount int) ([]string, error) {
+	cli.options.register(flags)
+	flags.SetOutput(cli.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(cli.stderr, "Usage: pcbook %s\n\nFlags:\n", usage)
+		flags.PrintDefaults()
+	}
+
+	var arguments []string
+	for {
+		err := flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, usageErrorf("%v", err)
+		}
+
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// The arguments following `--` are never flags
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			arguments = append(arguments, rest...)
+			break
+		}
+		arguments = append(arguments, rest[0])
+		args = rest[1:]
+	}
+
+	if len(arguments) != argCount {
+		flags.Usage()
+		return nil, usageErrorf("expected %d argument(s), got %d", argCount, len(arguments))
+	}
+	return arguments, nil
+}
+
+// connect returns a client of the server authenticated with the API key or the cached token, if any, and a context
+// cancelled with the timeout. Some RPCs, such as searching, are allowed anonymously.
+func (cli *cli) connect() (context.Context, *client.Client, func(), error) {
+	return cli.dial(true)
+}
+
+// connectAnonymously returns a client of the server without credentials, such as to log in again
+// once the cached token expired
+func (cli *cli) connectAnonymously() (context.Context, *client.Client, func(), error) {
+	return cli.dial(false)
+}
+
+func (cli *cli) dial(authenticated bool) (context.Context, *client.Client, func(), error) {
+	opts := cli.options
+	transportCredentials, err := client.LoadTLSCredentials(opts.tlsCA, opts.tlsCert, opts.tlsKey, opts.tlsServerName)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot load TLS credentials: %w", err)
+	}
+	clientOptions := []client.Option{client.WithTransportCredentials(transportCredentials)}
+	switch {
+	case !authenticated:
+		// Logging in never sends the cached token, which may have expired
+	case opts.apiKey != "":
+		clientOptions = append(clientOptions, client.WithCredentials(client.APIKey(opts.apiKey)))
+	default:
+		cache, err := loadCredentials(opts.configDir)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if cached, ok := cache.Servers[opts.address]; ok {
+			clientOptions = append(clientOptions, client.WithCredentials(client.Token(cached.AccessToken)))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	tracerProvider, err := service.NewTracerProvider(ctx, "pcbook-cli", opts.traceExporter, opts.traceTarget, opts.traceInsecure, 1)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, fmt.Errorf("cannot set up tracing: %w", err)
+	}
+	tracing := service.NewTracing(tracerProvider)
+	clientOptions = append(clientOptions, client.WithDialOptions(
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClient()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClient()),
+	))
+
+	pcbook, err := client.New(opts.address, clientOptions...)
+	if err != nil {
+		cancel()
+		tracerProvider.Close()
+		return nil, nil, nil, err
+	}
+
+	closeAll := func() {
+		pcbook.Close()
+		tracerProvider.Close()
+		cancel()
+	}
+	return ctx, pcbook, closeAll, nil
+}
+
+func main() {
+	cli := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+
+	err := cli.run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		err = nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pcbook: %s\n", describeError(err))
+	}
+	os.Exit(exitCode(err))
+}
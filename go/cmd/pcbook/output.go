@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/eshaanagg/pcbook/go/serializer"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// column is a column of the table output
+type column[M proto.Message] struct {
+	header string
+	value  func(message M) string
+}
+
+// printer writes the results of a command in the chosen format
+type printer struct {
+	writer io.Writer
+	format string
+}
+
+func newPrinter(writer io.Writer, format string) (*printer, error) {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return &printer{writer, format}, nil
+	default:
+		return nil, usageErrorf("unknown output format %q, expected table, json or yaml", format)
+	}
+}
+
+// printMessage writes a single result, with its protojson fields in the JSON and YAML formats
+func printMessage[M proto.Message](printer *printer, message M, columns []column[M]) error {
+	if printer.format == outputTable {
+		return printTable(printer.writer, []M{message}, columns)
+	}
+
+	value, err := messageValue(message)
+	if err != nil {
+		return err
+	}
+	return printer.encode(value)
+}
+
+// printList writes a list of results, as an array in the JSON and YAML formats
+func printList[M proto.Message](printer *printer, messages []M, columns []column[M]) error {
+	if printer.format == outputTable {
+		return printTable(printer.writer, messages, columns)
+	}
+
+	values := make([]interface{}, len(messages))
+	for i, message := range messages {
+		value, err := messageValue(message)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	return printer.encode(values)
+}
+
+func (printer *printer) encode(value interface{}) error {
+	if printer.format == outputYAML {
+		encoder := yaml.NewEncoder(printer.writer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	encoder := json.NewEncoder(printer.writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// messageValue decodes the protojson encoding of the message into generic values,
+// so that JSON and YAML use the same field names and enum names
+func messageValue(message proto.Message) (interface{}, error) {
+	data, err := serializer.JSONOptions.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal %s: %w", message.ProtoReflect().Descriptor().Name(), err)
+	}
+
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+func printTable[M proto.Message](writer io.Writer, messages []M, columns []column[M]) error {
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.header
+	}
+	fmt.Fprintln(table, strings.Join(headers, "\t"))
+
+	for _, message := range messages {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = column.value(message)
+		}
+		fmt.Fprintln(table, strings.Join(values, "\t"))
+	}
+
+	return table.Flush()
+}
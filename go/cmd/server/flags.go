@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/config"
+)
+
+// configFlags are the flags overriding a configuration key
+var configFlags = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"port", "server.port", "the server port"},
+	{"jwks-port", "server.jwks_port", "the HTTP port serving the JWKS, disabled if 0"},
+	{"metrics-port", "server.metrics_port", "the HTTP port serving the Prometheus metrics, disabled if 0"},
+	{"gateway-port", "server.gateway_port", "the HTTP port serving the REST/JSON gateway, disabled if 0"},
+	{"grpc-web-port", "server.grpc_web_port", "the HTTP port serving gRPC-Web, disabled if 0, may be the gateway port"},
+	{"allowed-origins", "server.allowed_origins", "the comma separated origins of the browser pages allowed to call the gateway and gRPC-Web"},
+	{"data-dir", "storage.data_dir", "the directory of the persistent stores"},
+	{"audit-dir", "audit.dir", "the directory of the JSON lines audit log, auditing is disabled if empty"},
+	{"policy", "auth.policy_file", "the YAML or JSON authorization policy file"},
+	{"tls-cert", "tls.cert_file", "the PEM certificate of the server, TLS is disabled if empty"},
+	{"tls-key", "tls.key_file", "the PEM private key of the server certificate"},
+	{"tls-client-ca", "tls.client_ca_file", "the PEM bundle of CAs used to verify client certificates"},
+	{"tls-client-auth", "tls.client_auth", "whether client certificates are verified: none, optional or require"},
+	{"log-level", "logging.level", "the minimum level of the logs: debug, info, warn or error"},
+}
+
+// configOverrides collects the flags overriding configuration keys, in the order they are given
+type configOverrides [][2]string
+
+// register adds the flags of every overridable key, and the generic --set flag
+func (overrides *configOverrides) register(flags *flag.FlagSet) {
+	for _, f := range configFlags {
+		key := f.key
+		flags.Func(f.name, fmt.Sprintf("%s (overrides %s)", f.usage, key), func(value string) error {
+			*overrides = append(*overrides, [2]string{key, value})
+			return nil
+		})
+	}
+
+	flags.Func("set", "overrides any configuration key as key=value, may be repeated", func(value string) error {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return errors.New("expected key=value")
+		}
+		*overrides = append(*overrides, [2]string{key, value})
+		return nil
+	})
+}
+
+func (overrides configOverrides) apply(cfg *config.Config) error {
+	for _, override := range overrides {
+		err := cfg.Set(override[0], override[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signingKeyFlags collects the repeated --jwt-key flags, each of the form `kid=path[@activeFrom]`
+type signingKeyFlags []config.SigningKeyConfig
+
+func (keys *signingKeyFlags) String() string {
+	ids := make([]string, len(*keys))
+	for i, key := range *keys {
+		ids[i] = key.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func (keys *signingKeyFlags) Set(value string) error {
+	id, path, ok := strings.Cut(value, "=")
+	if !ok || id == "" || path == "" {
+		return errors.New("expected kid=path[@activeFrom]")
+	}
+
+	key := config.SigningKeyConfig{ID: id}
+	path, activeFrom, scheduled := strings.Cut(path, "@")
+	key.File = path
+	if scheduled {
+		var err error
+		key.ActiveFrom, err = time.Parse(time.RFC3339, activeFrom)
+		if err != nil {
+			return fmt.Errorf("invalid activation time: %w", err)
+		}
+	}
+
+	*keys = append(*keys, key)
+	return nil
+}
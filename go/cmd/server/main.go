@@ -1,82 +1,418 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
-	"time"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
+	"github.com/eshaanagg/pcbook/go/config"
+	"github.com/eshaanagg/pcbook/go/openapi"
 	"github.com/eshaanagg/pcbook/go/pb"
 	"github.com/eshaanagg/pcbook/go/service"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
+	"gopkg.in/yaml.v3"
 )
 
-func accessibleRoles() map[string][]string {
-	const laptopServicePath = "/eshaanagg.pcbook.LaptopService/"
+// newUserStore opens the user store of the configured backend, and creates the initial admin on first start
+func newUserStore(storage config.StorageConfig, admin config.AdminConfig) (service.UserStore, error) {
+	var userStore service.UserStore = service.NewInMemoryUserStore()
+	if storage.Backend == config.BackendFile {
+		fileStore, err := service.NewFileUserStore(storage.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		userStore = fileStore
+	} else {
+		log.Print("Users are kept in memory and lost on restart")
+	}
 
-	return map[string][]string{
-		laptopServicePath + "CreateLaptop": {"admin"},
-		laptopServicePath + "UploadImage":  {"admin"},
-		laptopServicePath + "RateLaptop":   {"admin", "user"},
+	created, err := service.BootstrapAdmin(userStore, admin.Username, admin.Password)
+	if err != nil {
+		return nil, err
 	}
+
+	if created != "" && admin.Password == "" {
+		log.Printf("Created the initial admin %q with the generated password %q, it will not be shown again", admin.Username, created)
+	} else if created != "" {
+		log.Printf("Created the initial admin %q with the configured password", admin.Username)
+	}
+
+	return userStore, nil
 }
 
-func seedUsers(userStore service.UserStore) error {
-	err := service.CreateUser(userStore, "admin1", "secret", "admin")
+func newJWTManager(auth config.AuthConfig) (*service.JWTManager, error) {
+	if len(auth.SigningKeys) == 0 {
+		secret := auth.JWTSecret
+		if secret == "" {
+			random := make([]byte, 32)
+			if _, err := rand.Read(random); err != nil {
+				return nil, fmt.Errorf("cannot generate JWT secret: %w", err)
+			}
+			secret = base64.RawStdEncoding.EncodeToString(random)
+			log.Print("No JWT secret or signing key configured, tokens are signed with a random secret and invalidated on restart")
+		}
+		return service.NewJWTManager(secret, auth.TokenDuration.Duration), nil
+	}
+
+	keys := make([]*service.SigningKey, 0, len(auth.SigningKeys))
+	for _, keyConfig := range auth.SigningKeys {
+		key, err := service.LoadSigningKey(keyConfig.ID, keyConfig.File)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", keyConfig.ID, err)
+		}
+		key.ActiveFrom = keyConfig.ActiveFrom
+		keys = append(keys, key)
+	}
+
+	return service.NewJWTManagerWithKeys(auth.TokenDuration.Duration, keys...)
+}
+
+// serveHTTP starts an HTTP listener in the background, with TLS if a configuration is given
+func serveHTTP(name string, host string, port int, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	server := &http.Server{Addr: net.JoinHostPort(host, strconv.Itoa(port)), Handler: handler, TLSConfig: tlsConfig}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("Serving %s on %s://%s", name, scheme, server.Addr)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("cannot start %s server: %v", name, err)
+		}
+	}()
+
+	return server
+}
+
+// dialGateway connects the gateway to the gRPC server in process, so that its requests go through every
+// interceptor without needing a client certificate, and carry the address of their HTTP client
+func dialGateway(listener *service.GatewayListener, tracing *service.Tracing) (*grpc.ClientConn, error) {
+	return grpc.Dial(
+		"passthrough:///gateway",
+		grpc.WithContextDialer(listener.Dial),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClient()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClient()),
+	)
+}
+
+// tracingTarget returns the file or the collector the spans are exported to
+func tracingTarget(tracing config.TracingConfig) string {
+	if tracing.Exporter == service.TraceExporterOTLP {
+		return tracing.Endpoint
+	}
+	return tracing.File
+}
+
+// loadConfig builds the configuration from the file, the environment and the flags
+func loadConfig(filename string, overrides configOverrides, signingKeys signingKeyFlags) (*config.Config, error) {
+	cfg, err := config.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = overrides.apply(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	cfg.Auth.SigningKeys = append(cfg.Auth.SigningKeys, signingKeys...)
 
-	return service.CreateUser(userStore, "user1", "secret", "user")
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return cfg, nil
 }
 
-const (
-	secretKey     = "SuperSecretKey123$"
-	tokenDuration = 30 * time.Minute
-)
+// setupLogging sends the logs, including the ones of the log package, to a handler with the configured format and level.
+// The records logged during a request carry its request ID.
+func setupLogging(logging config.LoggingConfig) {
+	var level slog.Level
+	// The level was checked by the validation of the configuration
+	_ = level.UnmarshalText([]byte(logging.Level))
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if logging.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(service.NewLogHandler(handler)))
+}
 
 func main() {
-	port := flag.Int("port", 0, "the server port")
+	configFile := flag.String("config", os.Getenv("PCBOOK_CONFIG"), "the YAML, JSON or TOML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with the secrets redacted, and exit")
+	var overrides configOverrides
+	overrides.register(flag.CommandLine)
+	var signingKeys signingKeyFlags
+	flag.Var(&signingKeys, "jwt-key", "a PEM encoded RSA or Ed25519 key as kid=path[@activeFrom], may be repeated for rotation")
 	flag.Parse()
-	log.Printf("Start server on port: %v", *port)
 
-	userStore := service.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	cfg, err := loadConfig(*configFile, overrides, signingKeys)
 	if err != nil {
-		log.Fatalf("There was an error in adding the initial users to the store: %v", err)
+		log.Fatal(err)
+	}
+	if *printConfig {
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		err = encoder.Encode(cfg.Redacted())
+		if err != nil {
+			log.Fatalf("cannot print the configuration: %v", err)
+		}
+		return
 	}
-	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
-	authServer := service.NewAuthServer(userStore, jwtManager)
+	setupLogging(cfg.Logging)
+	log.Printf("Start server on port: %v", cfg.Server.Port)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// closers are the stores to close once the RPCs are drained
+	var closers []io.Closer
+	var httpServers []*http.Server
+	// grpcWebServers serve the gRPC server over HTTP, so they are stopped before it
+	var grpcWebServers []*http.Server
+
+	tracerProvider, err := service.NewTracerProvider(
+		ctx,
+		"pcbook-server",
+		cfg.Tracing.Exporter,
+		tracingTarget(cfg.Tracing),
+		cfg.Tracing.Insecure,
+		cfg.Tracing.SampleRatio,
+	)
+	if err != nil {
+		log.Fatalf("cannot set up tracing: %v", err)
+	}
+	// The tracer provider is closed last, to export the spans of the shutdown
+	closers = append(closers, tracerProvider)
+	tracing := service.NewTracing(tracerProvider)
+
+	tenantStore := service.NewInMemoryTenantStore()
+	_, err = service.CreateTenant(tenantStore, service.DefaultTenantID, "Default")
+	if err != nil {
+		log.Fatalf("cannot create the default tenant: %v", err)
+	}
+
+	userStore, err := newUserStore(cfg.Storage, cfg.Admin)
+	if err != nil {
+		log.Fatalf("cannot open the user store: %v", err)
+	}
+	if closer, ok := userStore.(io.Closer); ok {
+		closers = append(closers, closer)
+	}
+	jwtManager, err := newJWTManager(cfg.Auth)
+	if err != nil {
+		log.Fatalf("cannot create the JWT manager: %v", err)
+	}
+	if cfg.Server.JWKSPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle(service.JWKSPath, service.NewJWKSHandler(jwtManager))
+		httpServers = append(httpServers, serveHTTP("JWKS", cfg.Server.Host, cfg.Server.JWKSPort, mux, nil))
+	}
+	apiKeyStore := service.NewInMemoryAPIKeyStore()
+	loginAttemptStore := service.NewInMemoryLoginAttemptStore()
+	loginLimiter := service.NewLoginLimiter(
+		loginAttemptStore,
+		cfg.Limits.MaxLoginFailures,
+		cfg.Limits.LoginBackoff.Duration,
+		cfg.Limits.LoginLockout.Duration,
+	)
+	var auditLog service.AuditLog
+	if cfg.Audit.Dir != "" {
+		fileAuditLog, err := service.NewFileAuditLog(cfg.Audit.Dir, cfg.Audit.MaxFileSize, cfg.Audit.MaxFiles)
+		if err != nil {
+			log.Fatalf("cannot open the audit log: %v", err)
+		}
+		closers = append(closers, fileAuditLog)
+		auditLog = fileAuditLog
+	} else {
+		log.Print("No audit directory configured, auditing is disabled")
+	}
+	policy, err := service.NewPolicyWatcher(cfg.Auth.PolicyFile)
+	if err != nil {
+		log.Fatalf("cannot load the authorization policy: %v", err)
+	}
+	go policy.Watch(ctx, cfg.Auth.PolicyReloadInterval.Duration)
+
+	authServer := service.NewAuthServer(userStore, tenantStore, apiKeyStore, loginLimiter, jwtManager, auditLog, policy)
+
+	metrics := service.NewMetrics()
+	if cfg.Server.MetricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle(service.MetricsPath, metrics.Handler())
+		httpServers = append(httpServers, serveHTTP("metrics", cfg.Server.Host, cfg.Server.MetricsPort, mux, nil))
+	}
+
+	imageStore := service.NewDiskImageStore(cfg.Storage.ImageDir)
+	closers = append(closers, imageStore)
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
 	laptopServer := service.NewLaptopServer(
-		service.NewInMemoryLaptopStore(),
-		service.NewDiskImageStore("serializer/tmp"),
-		service.NewInMemoryRatingStore(),
+		metrics.LaptopStore(tracing.LaptopStore(laptopStore)),
+		metrics.ImageStore(tracing.ImageStore(imageStore)),
+		metrics.RatingStore(tracing.RatingStore(ratingStore)),
+		cfg.Limits.MaxImageSize,
+		policy,
 	)
 
-	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
+	transportCredentials := insecure.NewCredentials()
+	var certMapper *service.CertificateMapper
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		tlsConfig, err = service.LoadServerTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth)
+		if err != nil {
+			log.Fatalf("cannot load the TLS configuration: %v", err)
+		}
+		transportCredentials = credentials.NewTLS(tlsConfig)
+		if cfg.TLS.ClientAuth != service.ClientAuthNone {
+			certMapper = service.NewCertificateMapper(nil, tenantStore)
+		}
+	} else {
+		log.Print("No TLS certificate configured, serving without TLS")
+	}
+
+	rateLimits := make([]service.RateLimit, len(cfg.Limits.RateLimits))
+	for i, limit := range cfg.Limits.RateLimits {
+		rateLimits[i] = service.RateLimit{Method: limit.Method, Rate: limit.Rate, Burst: limit.Burst}
+	}
+	rateLimiter, err := service.NewRateLimiter(rateLimits...)
+	if err != nil {
+		log.Fatalf("cannot create the rate limiter: %v", err)
+	}
+
+	requestIDInterceptor := service.NewRequestIDInterceptor()
+	recoveryInterceptor := service.NewRecoveryInterceptor()
+	errorInterceptor := service.NewErrorInterceptor()
+	interceptor := service.NewAuthInterceptor(jwtManager, apiKeyStore, certMapper, policy, auditLog)
 	serverOptions := []grpc.ServerOption{
-		grpc.UnaryInterceptor(interceptor.Unary()),
-		grpc.StreamInterceptor(interceptor.Stream()),
+		// The in-process connections of the gateway skip the TLS handshake
+		grpc.Creds(service.GatewayCredentials(transportCredentials)),
+		// The request ID comes first so that the log lines of every other interceptor carry it, including
+		// the panics, which are recovered next so that a panic in any later interceptor does not crash the server,
+		// the trace comes next so that the spans cover every other interceptor, the metrics come before
+		// the AuthInterceptor to also count the calls it denies,
+		// the rate limiter comes after it to throttle each user separately, and the errors are normalized
+		// last so that every other interceptor sees the status of the panics and the store errors
+		grpc.ChainUnaryInterceptor(
+			requestIDInterceptor.Unary(),
+			recoveryInterceptor.Unary(),
+			tracing.Unary(),
+			metrics.Unary(),
+			interceptor.Unary(),
+			rateLimiter.Unary(),
+			errorInterceptor.Unary(),
+		),
+		grpc.ChainStreamInterceptor(
+			requestIDInterceptor.Stream(),
+			recoveryInterceptor.Stream(),
+			tracing.Stream(),
+			metrics.Stream(),
+			interceptor.Stream(),
+			rateLimiter.Stream(),
+			errorInterceptor.Stream(),
+		),
 	}
 	grpcServer := grpc.NewServer(serverOptions...)
 
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 	pb.RegisterAuthServiceServer(grpcServer, authServer)
 
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	healthMonitor := service.NewHealthMonitor(healthServer)
+	healthMonitor.Register(pb.LaptopService_ServiceDesc.ServiceName, laptopStore, imageStore, ratingStore)
+	healthMonitor.Register(pb.AuthService_ServiceDesc.ServiceName, userStore, tenantStore, apiKeyStore, loginAttemptStore)
+	go healthMonitor.Watch(ctx, cfg.Server.HealthCheckInterval.Duration)
+	if cfg.Server.HealthPort != 0 {
+		httpServers = append(httpServers, serveHTTP("health probes", cfg.Server.Host, cfg.Server.HealthPort, service.NewHealthHandler(healthMonitor), nil))
+	}
 	reflection.Register(grpcServer)
 
-	address := fmt.Sprintf("0.0.0.0:%d", *port)
+	address := net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port))
 	listener, err := net.Listen("tcp", address)
 
 	if err != nil {
 		log.Fatalf("cannot start server: %v", err)
 	}
 
-	err = grpcServer.Serve(listener)
-	if err != nil {
-		log.Fatalf("cannot start server: %v", err)
+	// The gateway and gRPC-Web serve browsers, so they use TLS when it is configured
+	var gateway http.Handler
+	var gatewayListener *service.GatewayListener
+	if cfg.Server.GatewayPort != 0 {
+		gatewayListener = service.NewGatewayListener()
+		conn, err := dialGateway(gatewayListener, tracing)
+		if err != nil {
+			log.Fatalf("cannot connect the gateway to the server: %v", err)
+		}
+		closers = append(closers, conn)
+		mux := http.NewServeMux()
+		mux.Handle(service.GatewayPrefix, service.NewGateway(conn))
+		mux.Handle(openapi.Path, openapi.Handler())
+		gateway = service.NewCORSHandler(mux, cfg.Server.AllowedOrigins)
 	}
+	if cfg.Server.GRPCWebPort != 0 {
+		var next http.Handler
+		if cfg.Server.GRPCWebPort == cfg.Server.GatewayPort {
+			next, gateway = gateway, nil
+		}
+		grpcWeb := service.NewGRPCWebHandler(grpcServer, cfg.Server.AllowedOrigins, next)
+		grpcWebServers = append(grpcWebServers, serveHTTP("gRPC-Web", cfg.Server.Host, cfg.Server.GRPCWebPort, grpcWeb, tlsConfig))
+	}
+	if gateway != nil {
+		httpServers = append(httpServers, serveHTTP("REST gateway", cfg.Server.Host, cfg.Server.GatewayPort, gateway, tlsConfig))
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- grpcServer.Serve(listener)
+	}()
+	if gatewayListener != nil {
+		go func() {
+			serveErr <- grpcServer.Serve(gatewayListener)
+		}()
+	}
+
+	exitCode := exitOK
+	select {
+	case err = <-serveErr:
+		log.Printf("The server stopped unexpectedly: %v", err)
+		exitCode = exitError
+	case <-ctx.Done():
+		log.Print("Received a shutdown signal, draining in-flight RPCs")
+	}
+	// A second signal kills the server right away
+	stop()
+
+	if !shutdown(grpcServer, healthMonitor, grpcWebServers, httpServers, closers, cfg.Server.ShutdownTimeout.Duration) {
+		exitCode = exitError
+	}
+
+	log.Printf("Server stopped with exit status %d", exitCode)
+	os.Exit(exitCode)
 }
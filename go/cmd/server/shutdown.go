@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"google.golang.org/grpc"
+)
+
+// Exit statuses of the server
+const (
+	exitOK = 0
+	// exitError means that the server failed, or that the shutdown did not complete cleanly
+	exitError = 1
+)
+
+// shutdown stops the server in order: the health status turns NOT_SERVING so that load balancers stop
+// sending requests, then new connections are refused while in-flight requests drain until the timeout,
+// after which they are cancelled, and finally the stores are closed.
+// The gRPC-Web servers are drained before the gRPC server, whose GracefulStop cannot drain their connections,
+// while the other HTTP servers drain alongside it. It returns false if anything did not stop cleanly.
+func shutdown(grpcServer *grpc.Server, healthMonitor *service.HealthMonitor, grpcWebServers []*http.Server, httpServers []*http.Server, closers []io.Closer, timeout time.Duration) bool {
+	healthMonitor.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	httpClean := make(chan bool, 1)
+	go func() {
+		httpClean <- shutdownHTTP(ctx, httpServers)
+	}()
+
+	clean := shutdownHTTP(ctx, grpcWebServers)
+	if clean {
+		clean = shutdownGRPC(ctx, grpcServer, timeout)
+	} else {
+		// The connections of the gRPC-Web servers may still be open, which GracefulStop would panic on
+		log.Printf("In-flight gRPC-Web requests did not complete within %v, cancelling the RPCs", timeout)
+		grpcServer.Stop()
+	}
+	if !<-httpClean {
+		clean = false
+	}
+
+	// The stores are closed in the reverse order of their creation
+	for i := len(closers) - 1; i >= 0; i-- {
+		err := closers[i].Close()
+		if err != nil {
+			log.Printf("cannot close store: %v", err)
+			clean = false
+		}
+	}
+
+	return clean
+}
+
+// shutdownGRPC drains the in-flight RPCs until the context is done, after which they are cancelled
+func shutdownGRPC(ctx context.Context, grpcServer *grpc.Server, timeout time.Duration) bool {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Print("All in-flight RPCs completed")
+		return true
+	case <-ctx.Done():
+		log.Printf("In-flight RPCs did not complete within %v, cancelling them", timeout)
+		grpcServer.Stop()
+		<-stopped
+		return false
+	}
+}
+
+// shutdownHTTP drains the in-flight requests of the HTTP servers until the context is done,
+// after which their connections are closed
+func shutdownHTTP(ctx context.Context, httpServers []*http.Server) bool {
+	var wg sync.WaitGroup
+	var clean atomic.Bool
+	clean.Store(true)
+	for _, httpServer := range httpServers {
+		wg.Add(1)
+		go func(httpServer *http.Server) {
+			defer wg.Done()
+
+			err := httpServer.Shutdown(ctx)
+			if err != nil {
+				log.Printf("cannot shut down the HTTP server on %s: %v", httpServer.Addr, err)
+				httpServer.Close()
+				clean.Store(false)
+			}
+		}(httpServer)
+	}
+
+	wg.Wait()
+	return clean.Load()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// startGRPCWeb serves the health service of a gRPC server over gRPC-Web
+func startGRPCWeb(t *testing.T) (*grpc.Server, *service.HealthMonitor, *http.Server, string) {
+	healthServer := health.NewServer()
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	grpcWebServer := &http.Server{Handler: service.NewGRPCWebHandler(grpcServer, []string{"*"}, nil)}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go grpcWebServer.Serve(listener)
+
+	return grpcServer, service.NewHealthMonitor(healthServer), grpcWebServer, "http://" + listener.Addr().String()
+}
+
+// callGRPCWeb starts a gRPC-Web call of the health service and returns its response once the first message is received
+func callGRPCWeb(t *testing.T, url string, method string) *http.Response {
+	data, err := proto.Marshal(&healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	body := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(data)))
+	body = append(body, data...)
+
+	req, err := http.NewRequest(http.MethodPost, url+"/grpc.health.v1.Health/"+method, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	header := make([]byte, 5)
+	_, err = io.ReadFull(res.Body, header)
+	require.NoError(t, err)
+	return res
+}
+
+func TestShutdownWithOpenGRPCWebStream(t *testing.T) {
+	t.Parallel()
+
+	grpcServer, healthMonitor, grpcWebServer, url := startGRPCWeb(t)
+
+	// A Watch stream stays open until it is cancelled
+	res := callGRPCWeb(t, url, "Watch")
+	defer res.Body.Close()
+
+	start := time.Now()
+	clean := shutdown(grpcServer, healthMonitor, []*http.Server{grpcWebServer}, nil, nil, 200*time.Millisecond)
+	require.False(t, clean)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// The stream was cancelled
+	_, err := io.ReadAll(res.Body)
+	require.Error(t, err)
+}
+
+func TestShutdownAfterGRPCWebCall(t *testing.T) {
+	t.Parallel()
+
+	grpcServer, healthMonitor, grpcWebServer, url := startGRPCWeb(t)
+
+	res := callGRPCWeb(t, url, "Check")
+	_, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	// The idle gRPC-Web connection is closed before the gRPC server drains
+	clean := shutdown(grpcServer, healthMonitor, []*http.Server{grpcWebServer}, nil, nil, time.Second)
+	require.True(t, clean)
+}
@@ -0,0 +1,474 @@
+// Package config defines the configuration of the pcbook server. The configuration is built from
+// the defaults, then a YAML, JSON or TOML file, then the PCBOOK_* environment variables, and finally the flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/eshaanagg/pcbook/go/service"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the configuration.
+// The variable of a key is the key in upper case with dots replaced by underscores,
+// such as PCBOOK_SERVER_PORT for `server.port`.
+const EnvPrefix = "PCBOOK_"
+
+const redacted = "REDACTED"
+
+type Config struct {
+	Server  ServerConfig  `yaml:"server" toml:"server"`
+	TLS     TLSConfig     `yaml:"tls" toml:"tls"`
+	Storage StorageConfig `yaml:"storage" toml:"storage"`
+	Auth    AuthConfig    `yaml:"auth" toml:"auth"`
+	Admin   AdminConfig   `yaml:"admin" toml:"admin"`
+	Limits  LimitsConfig  `yaml:"limits" toml:"limits"`
+	Audit   AuditConfig   `yaml:"audit" toml:"audit"`
+	Logging LoggingConfig `yaml:"logging" toml:"logging"`
+	Tracing TracingConfig `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Host string `yaml:"host" toml:"host"`
+	Port int    `yaml:"port" toml:"port"`
+	// JWKSPort is the HTTP port of the JWKS endpoint, which is disabled if zero
+	JWKSPort int `yaml:"jwks_port" toml:"jwks_port"`
+	// HealthPort is the HTTP port of the /healthz and /readyz probes, which are disabled if zero
+	HealthPort          int      `yaml:"health_port" toml:"health_port"`
+	HealthCheckInterval Duration `yaml:"health_check_interval" toml:"health_check_interval"`
+	// MetricsPort is the HTTP port of the Prometheus /metrics endpoint, which is disabled if zero
+	MetricsPort int `yaml:"metrics_port" toml:"metrics_port"`
+	// GatewayPort is the HTTP port of the REST/JSON gateway, which is disabled if zero
+	GatewayPort int `yaml:"gateway_port" toml:"gateway_port"`
+	// GRPCWebPort is the HTTP port of gRPC-Web, which is disabled if zero. It may be the port of the gateway.
+	GRPCWebPort int `yaml:"grpc_web_port" toml:"grpc_web_port"`
+	// AllowedOrigins are the origins of the browser pages allowed to call the gateway and gRPC-Web, `*` allowing any.
+	// A comma separated list when set from a flag or the environment.
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	// ShutdownTimeout is how long in-flight RPCs are drained for on shutdown, before they are cancelled
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type TLSConfig struct {
+	// CertFile is the PEM certificate of the server, TLS is disabled if empty
+	CertFile     string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" toml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// ClientAuth is none, optional or require
+	ClientAuth string `yaml:"client_auth" toml:"client_auth"`
+}
+
+// Storage backends
+const (
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+type StorageConfig struct {
+	// Backend of the user store, either memory or file
+	Backend string `yaml:"backend" toml:"backend"`
+	// DataDir holds the files of the file backend
+	DataDir  string `yaml:"data_dir" toml:"data_dir"`
+	ImageDir string `yaml:"image_dir" toml:"image_dir"`
+}
+
+type AuthConfig struct {
+	TokenDuration Duration `yaml:"token_duration" toml:"token_duration"`
+	// JWTSecret signs HS256 tokens when no signing key is configured.
+	// A random secret is generated at startup if both are empty.
+	JWTSecret            string             `yaml:"jwt_secret" toml:"jwt_secret" secret:"true"`
+	SigningKeys          []SigningKeyConfig `yaml:"signing_keys" toml:"signing_keys"`
+	PolicyFile           string             `yaml:"policy_file" toml:"policy_file"`
+	PolicyReloadInterval Duration           `yaml:"policy_reload_interval" toml:"policy_reload_interval"`
+}
+
+// SigningKeyConfig is a PEM encoded RSA or Ed25519 key used to sign or verify tokens
+type SigningKeyConfig struct {
+	ID         string    `yaml:"id" toml:"id"`
+	File       string    `yaml:"file" toml:"file"`
+	ActiveFrom time.Time `yaml:"active_from,omitempty" toml:"active_from,omitempty"`
+}
+
+// AdminConfig is the initial admin, created on the first start only
+type AdminConfig struct {
+	Username string `yaml:"username" toml:"username"`
+	// Password is generated and logged once if empty
+	Password string `yaml:"password" toml:"password" secret:"true"`
+}
+
+type LimitsConfig struct {
+	MaxImageSize     int      `yaml:"max_image_size" toml:"max_image_size"`
+	MaxLoginFailures int      `yaml:"max_login_failures" toml:"max_login_failures"`
+	LoginBackoff     Duration `yaml:"login_backoff" toml:"login_backoff"`
+	LoginLockout     Duration `yaml:"login_lockout" toml:"login_lockout"`
+	// RateLimits are the budgets of the callers of each method, the first matching one applies
+	RateLimits []RateLimitConfig `yaml:"rate_limits" toml:"rate_limits"`
+}
+
+type RateLimitConfig struct {
+	// Method is a pattern such as `/eshaanagg.pcbook.LaptopService/*`
+	Method string  `yaml:"method" toml:"method"`
+	Rate   float64 `yaml:"rate" toml:"rate"`
+	Burst  int     `yaml:"burst" toml:"burst"`
+}
+
+type AuditConfig struct {
+	// Dir holds the JSON lines audit log, auditing is disabled if empty
+	Dir         string `yaml:"dir" toml:"dir"`
+	MaxFileSize int64  `yaml:"max_file_size" toml:"max_file_size"`
+	MaxFiles    int    `yaml:"max_files" toml:"max_files"`
+}
+
+type LoggingConfig struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level" toml:"level"`
+	// Format is text or json
+	Format string `yaml:"format" toml:"format"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout, file or otlp
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// File receives the spans of the file exporter
+	File string `yaml:"file" toml:"file"`
+	// Endpoint is the host:port of the collector of the otlp exporter
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// Insecure disables TLS towards the collector
+	Insecure bool `yaml:"insecure" toml:"insecure"`
+	// SampleRatio is the fraction of the traces started by the server that are recorded
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Duration is a time.Duration written as a string such as "30m" in the configuration
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+// Default returns the configuration used for the keys that are not set
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Host:                "0.0.0.0",
+			Port:                8080,
+			ShutdownTimeout:     Duration{30 * time.Second},
+			HealthCheckInterval: Duration{10 * time.Second},
+		},
+		TLS: TLSConfig{
+			ClientAuth: service.ClientAuthNone,
+		},
+		Storage: StorageConfig{
+			Backend:  BackendFile,
+			DataDir:  "data",
+			ImageDir: "serializer/tmp",
+		},
+		Auth: AuthConfig{
+			TokenDuration:        Duration{30 * time.Minute},
+			PolicyFile:           "policy.yaml",
+			PolicyReloadInterval: Duration{5 * time.Second},
+		},
+		Admin: AdminConfig{
+			Username: "admin",
+		},
+		Limits: LimitsConfig{
+			MaxImageSize:     service.DefaultMaxImageSize,
+			MaxLoginFailures: 5,
+			LoginBackoff:     Duration{time.Second},
+			LoginLockout:     Duration{15 * time.Minute},
+			RateLimits: []RateLimitConfig{
+				{Method: "/eshaanagg.pcbook.LaptopService/CreateLaptop", Rate: 10, Burst: 20},
+				{Method: "/eshaanagg.pcbook.LaptopService/RateLaptop", Rate: 20, Burst: 40},
+			},
+		},
+		Audit: AuditConfig{
+			Dir:         "data/audit",
+			MaxFileSize: 10 << 20,
+			MaxFiles:    10,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			Exporter:    service.TraceExporterNone,
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load returns the default configuration overridden by a file, if the filename is not empty,
+// and then by the environment. Unknown keys in the file are errors.
+func Load(filename string) (*Config, error) {
+	cfg := Default()
+	if filename != "" {
+		err := cfg.loadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := cfg.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("cannot parse config file %s: %w", filename, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("cannot parse config file %s: %w", filename, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys in config file %s: %v", filename, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format: %s", filename)
+	}
+
+	return nil
+}
+
+// ApplyEnv overrides the keys that have an environment variable
+func (cfg *Config) ApplyEnv(lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(key string, value reflect.Value, field reflect.StructField) {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if env, ok := lookupEnv(name); ok {
+			err := setValue(value, env)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Set overrides a key, such as `server.port`, with a value parsed from a string
+func (cfg *Config) Set(key string, value string) error {
+	found := false
+	var err error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.Value, _ reflect.StructField) {
+		if path == key {
+			found = true
+			err = setValue(field, value)
+		}
+	})
+
+	if !found {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration and reports every invalid key
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Port >= 0 && cfg.Server.Port <= 65535, "server.port: %d is not a valid port", cfg.Server.Port)
+	check(cfg.Server.JWKSPort >= 0 && cfg.Server.JWKSPort <= 65535, "server.jwks_port: %d is not a valid port", cfg.Server.JWKSPort)
+	check(cfg.Server.HealthPort >= 0 && cfg.Server.HealthPort <= 65535, "server.health_port: %d is not a valid port", cfg.Server.HealthPort)
+	check(cfg.Server.MetricsPort >= 0 && cfg.Server.MetricsPort <= 65535, "server.metrics_port: %d is not a valid port", cfg.Server.MetricsPort)
+	check(cfg.Server.GatewayPort >= 0 && cfg.Server.GatewayPort <= 65535, "server.gateway_port: %d is not a valid port", cfg.Server.GatewayPort)
+	check(cfg.Server.GRPCWebPort >= 0 && cfg.Server.GRPCWebPort <= 65535, "server.grpc_web_port: %d is not a valid port", cfg.Server.GRPCWebPort)
+	for _, origin := range cfg.Server.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		check(err == nil && parsed.Scheme != "" && parsed.Host != "" && parsed.Path == "",
+			"server.allowed_origins: %q is not an origin such as https://example.com", origin)
+	}
+	check(cfg.Server.HealthCheckInterval.Duration > 0, "server.health_check_interval: must be positive")
+	check(cfg.Server.ShutdownTimeout.Duration > 0, "server.shutdown_timeout: must be positive")
+
+	check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	switch cfg.TLS.ClientAuth {
+	case service.ClientAuthNone:
+	case service.ClientAuthOptional, service.ClientAuthRequire:
+		check(cfg.TLS.CertFile != "", "tls.client_auth: %s requires tls.cert_file", cfg.TLS.ClientAuth)
+		check(cfg.TLS.ClientCAFile != "", "tls.client_auth: %s requires tls.client_ca_file", cfg.TLS.ClientAuth)
+	default:
+		check(false, "tls.client_auth: must be none, optional or require, not %q", cfg.TLS.ClientAuth)
+	}
+	// The gateway calls the server without a client certificate
+	check(cfg.Server.GatewayPort == 0 || cfg.TLS.ClientAuth != service.ClientAuthRequire,
+		"server.gateway_port: cannot be used with tls.client_auth require")
+
+	switch cfg.Storage.Backend {
+	case BackendMemory:
+	case BackendFile:
+		check(cfg.Storage.DataDir != "", "storage.data_dir: is required by the file backend")
+	default:
+		check(false, "storage.backend: must be memory or file, not %q", cfg.Storage.Backend)
+	}
+	check(cfg.Storage.ImageDir != "", "storage.image_dir: is required")
+
+	check(cfg.Auth.TokenDuration.Duration > 0, "auth.token_duration: must be positive")
+	check(cfg.Auth.PolicyFile != "", "auth.policy_file: is required")
+	check(cfg.Auth.PolicyReloadInterval.Duration > 0, "auth.policy_reload_interval: must be positive")
+	for i, key := range cfg.Auth.SigningKeys {
+		check(key.ID != "" && key.File != "", "auth.signing_keys[%d]: id and file are required", i)
+	}
+	check(cfg.Admin.Username != "", "admin.username: is required")
+
+	check(cfg.Limits.MaxImageSize > 0, "limits.max_image_size: must be positive")
+	check(cfg.Limits.MaxLoginFailures > 0, "limits.max_login_failures: must be positive")
+	check(cfg.Limits.LoginBackoff.Duration >= 0, "limits.login_backoff: must not be negative")
+	check(cfg.Limits.LoginLockout.Duration > 0, "limits.login_lockout: must be positive")
+	for i, limit := range cfg.Limits.RateLimits {
+		_, err := path.Match(limit.Method, "")
+		check(limit.Method != "" && err == nil, "limits.rate_limits[%d]: %q is not a valid method pattern", i, limit.Method)
+		check(limit.Rate > 0 && limit.Burst > 0, "limits.rate_limits[%d]: rate and burst must be positive", i)
+	}
+
+	if cfg.Audit.Dir != "" {
+		check(cfg.Audit.MaxFileSize > 0, "audit.max_file_size: must be positive")
+		check(cfg.Audit.MaxFiles >= 0, "audit.max_files: must not be negative")
+	}
+
+	switch cfg.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level: must be debug, info, warn or error, not %q", cfg.Logging.Level)
+	}
+	check(cfg.Logging.Format == "text" || cfg.Logging.Format == "json", "logging.format: must be text or json, not %q", cfg.Logging.Format)
+
+	switch cfg.Tracing.Exporter {
+	case service.TraceExporterNone, service.TraceExporterStdout:
+	case service.TraceExporterFile:
+		check(cfg.Tracing.File != "", "tracing.file: is required by the file exporter")
+	case service.TraceExporterOTLP:
+		check(cfg.Tracing.Endpoint != "", "tracing.endpoint: is required by the otlp exporter")
+	default:
+		check(false, "tracing.exporter: must be none, stdout, file or otlp, not %q", cfg.Tracing.Exporter)
+	}
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with the secrets masked, for printing
+func (cfg *Config) Redacted() *Config {
+	other := *cfg
+	other.Auth.SigningKeys = append([]SigningKeyConfig(nil), cfg.Auth.SigningKeys...)
+	other.Limits.RateLimits = append([]RateLimitConfig(nil), cfg.Limits.RateLimits...)
+	walk(reflect.ValueOf(&other).Elem(), "", func(_ string, value reflect.Value, field reflect.StructField) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString(redacted)
+		}
+	})
+
+	return &other
+}
+
+// walk calls fn for every leaf key of the configuration, named by the path of its YAML keys
+func walk(value reflect.Value, prefix string, fn func(key string, value reflect.Value, field reflect.StructField)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Struct && fieldValue.Type() != reflect.TypeOf(Duration{}) {
+			walk(fieldValue, key, fn)
+			continue
+		}
+		fn(key, fieldValue, field)
+	}
+}
+
+func setValue(value reflect.Value, text string) error {
+	if value.Type() == reflect.TypeOf(Duration{}) {
+		return value.Addr().Interface().(*Duration).UnmarshalText([]byte(text))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", text)
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return errors.New("cannot be set from a string, use the config file")
+		}
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return errors.New("cannot be set from a string, use the config file")
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/config"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	filename := writeConfig(t, "pcbook.yaml", `
+server:
+  port: 9000
+auth:
+  token_duration: 1h
+  jwt_secret: from-file
+limits:
+  max_login_failures: 3
+`)
+
+	t.Setenv("PCBOOK_SERVER_PORT", "9001")
+	t.Setenv("PCBOOK_LIMITS_LOGIN_LOCKOUT", "1m")
+	cfg, err := config.Load(filename)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Set("limits.max_login_failures", "7"))
+	require.NoError(t, cfg.Validate())
+
+	require.Equal(t, 9001, cfg.Server.Port)
+	require.Equal(t, time.Hour, cfg.Auth.TokenDuration.Duration)
+	require.Equal(t, time.Minute, cfg.Limits.LoginLockout.Duration)
+	require.Equal(t, 7, cfg.Limits.MaxLoginFailures)
+	// Keys that are not overridden keep their default
+	require.Equal(t, config.Default().Storage, cfg.Storage)
+
+	redacted := cfg.Redacted()
+	require.Equal(t, "REDACTED", redacted.Auth.JWTSecret)
+	require.Empty(t, redacted.Admin.Password)
+	require.Equal(t, "from-file", cfg.Auth.JWTSecret)
+}
+
+func TestLoadTOML(t *testing.T) {
+	t.Parallel()
+
+	filename := writeConfig(t, "pcbook.toml", `
+[storage]
+backend = "memory"
+
+[[auth.signing_keys]]
+id = "2024"
+file = "keys/2024.pem"
+`)
+
+	cfg, err := config.Load(filename)
+	require.NoError(t, err)
+	require.Equal(t, config.BackendMemory, cfg.Storage.Backend)
+	require.Len(t, cfg.Auth.SigningKeys, 1)
+	require.Equal(t, "keys/2024.pem", cfg.Auth.SigningKeys[0].File)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := config.Load(writeConfig(t, "pcbook.yaml", "server:\n  prot: 8080\n"))
+	require.ErrorContains(t, err, "prot")
+
+	_, err = config.Load(writeConfig(t, "pcbook.toml", "[server]\nprot = 8080\n"))
+	require.ErrorContains(t, err, "prot")
+
+	cfg := config.Default()
+	require.Error(t, cfg.Set("server.unknown", "1"))
+	require.Error(t, cfg.Set("server.port", "eighty"))
+	require.Error(t, cfg.Set("auth.signing_keys", "key"))
+
+	require.NoError(t, cfg.Set("server.allowed_origins", "https://pcbook.dev, http://localhost:3000"))
+	require.Equal(t, []string{"https://pcbook.dev", "http://localhost:3000"}, cfg.Server.AllowedOrigins)
+
+	cfg.Storage.Backend = "postgres"
+	cfg.TLS.ClientAuth = "require"
+	cfg.Server.AllowedOrigins = append(cfg.Server.AllowedOrigins, "pcbook.dev")
+	err = cfg.Validate()
+	require.ErrorContains(t, err, "storage.backend")
+	require.ErrorContains(t, err, "tls.client_ca_file")
+	require.ErrorContains(t, err, `"pcbook.dev" is not an origin`)
+}
@@ -0,0 +1,349 @@
+// Package openapi describes the HTTP gateway of the pcbook server as an OpenAPI 3 document. The schemas are
+// generated from the descriptors of the proto messages, so that they follow their protojson encoding.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Path is the path at which the document is served
+const Path = "/openapi.json"
+
+// Spec is the generated document, which `make openapi` updates after the protos change
+//
+//go:embed openapi.json
+var Spec []byte
+
+// object is a JSON object of the document
+type object = map[string]interface{}
+
+// Handler serves the generated document
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if _, err := w.Write(Spec); err != nil {
+			slog.WarnContext(r.Context(), "Cannot write the OpenAPI document", "error", err)
+		}
+	})
+}
+
+// Generate returns the document of the gateway routes, as indented JSON
+func Generate() ([]byte, error) {
+	generator := &generator{schemas: object{}}
+	paths := object{
+		"/v1/login": object{
+			"post": generator.operation(operation{
+				id:          "Login",
+				summary:     "Log in with a username and a password",
+				description: "Returns an access token, sent by the other requests as `Authorization: Bearer <access_token>` until it expires.",
+				anonymous:   true,
+				request:     (&pb.LoginRequest{}).ProtoReflect().Descriptor(),
+				status:      "200",
+				response:    (&pb.LoginResponse{}).ProtoReflect().Descriptor(),
+			}),
+		},
+		"/v1/laptops": object{
+			"post": generator.operation(operation{
+				id:          "CreateLaptop",
+				summary:     "Create a laptop",
+				description: "The ID is generated if it is empty. Every invalid field is reported in the `google.rpc.BadRequest` detail of the error.",
+				request:     (&pb.Laptop{}).ProtoReflect().Descriptor(),
+				status:      "201",
+				response:    (&pb.CreateLaptopResponse{}).ProtoReflect().Descriptor(),
+			}),
+			"get": generator.operation(operation{
+				id:          "SearchLaptop",
+				summary:     "Search the laptops matching a filter",
+				description: "The laptops are streamed as newline delimited JSON. An error occurring after the first laptop ends the stream with an `{\"error\": Status}` line.",
+				query:       (&pb.Filter{}).ProtoReflect().Descriptor(),
+				status:      "200",
+				response:    (&pb.Laptop{}).ProtoReflect().Descriptor(),
+				contentType: "application/x-ndjson",
+			}),
+		},
+		"/v1/laptops/{id}/images": object{
+			"post": generator.operation(operation{
+				id:          "UploadImage",
+				summary:     "Upload an image of a laptop",
+				description: "The image type is the extension of the file name.",
+				laptopID:    true,
+				multipart:   true,
+				status:      "201",
+				response:    (&pb.UploadImageResponse{}).ProtoReflect().Descriptor(),
+			}),
+		},
+		"/v1/laptops/{id}/ratings": object{
+			"post": generator.operation(operation{
+				id:          "RateLaptop",
+				summary:     "Rate a laptop",
+				description: "The `laptop_id` of the body is replaced by the ID of the path.",
+				laptopID:    true,
+				request:     (&pb.RateLaptopRequest{}).ProtoReflect().Descriptor(),
+				status:      "200",
+				response:    (&pb.RateLaptopResponse{}).ProtoReflect().Descriptor(),
+			}),
+		},
+	}
+	// The filter of the search is also given as a schema, as its fields are query parameters
+	generator.message((&pb.Filter{}).ProtoReflect().Descriptor())
+	generator.schemas["Status"] = statusSchema
+
+	document := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "PCBook",
+			"version":     "v1",
+			"description": "The REST/JSON gateway of the LaptopService and the AuthService. The JSON names of the fields are their proto names, and the enums are encoded by name.",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": generator.schemas,
+			"securitySchemes": object{
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     object{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []interface{}{object{"bearerAuth": []string{}}, object{"apiKey": []string{}}},
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// statusSchema is the google.rpc.Status of the errors
+var statusSchema = object{
+	"type": "object",
+	"properties": object{
+		"code":    object{"type": "integer", "format": "int32", "description": "The gRPC status code"},
+		"message": object{"type": "string"},
+		"details": object{
+			"type": "array",
+			"items": object{
+				"type":                 "object",
+				"properties":           object{"@type": object{"type": "string"}},
+				"additionalProperties": true,
+			},
+			"description": "Details such as google.rpc.BadRequest, RetryInfo and QuotaFailure",
+		},
+	},
+}
+
+// operation describes a gateway route
+type operation struct {
+	id          string
+	summary     string
+	description string
+	// anonymous operations do not require credentials
+	anonymous bool
+	// laptopID adds the `id` path parameter
+	laptopID bool
+	// query is the message whose fields are the query parameters
+	query protoreflect.MessageDescriptor
+	// request is the JSON body, unless the body is a multipart form with an image
+	request   protoreflect.MessageDescriptor
+	multipart bool
+	status    string
+	response  protoreflect.MessageDescriptor
+	// contentType of the response, application/json by default
+	contentType string
+}
+
+// generator collects the schemas of the messages referenced by the operations
+type generator struct {
+	schemas object
+}
+
+func (generator *generator) operation(op operation) object {
+	contentType := op.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	errorResponse := func(description string) object {
+		return object{
+			"description": description,
+			"content":     object{"application/json": object{"schema": reference("Status")}},
+		}
+	}
+	responses := object{
+		op.status: object{
+			"description": "OK",
+			"content":     object{contentType: object{"schema": generator.message(op.response)}},
+		},
+		"400":     errorResponse("Invalid argument"),
+		"429":     errorResponse("Rate limited, retry after the Retry-After header"),
+		"default": errorResponse("The gRPC status of the error"),
+	}
+
+	result := object{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"description": op.description,
+		"responses":   responses,
+	}
+	if op.anonymous {
+		result["security"] = []interface{}{}
+	} else {
+		responses["401"] = errorResponse("Missing or invalid credentials")
+		responses["403"] = errorResponse("Not allowed by the authorization policy")
+	}
+
+	var parameters []interface{}
+	if op.laptopID {
+		parameters = append(parameters, object{
+			"name":     "id",
+			"in":       "path",
+			"required": true,
+			"schema":   object{"type": "string", "format": "uuid"},
+		})
+		responses["404"] = errorResponse("Laptop not found")
+	}
+	if op.query != nil {
+		parameters = append(parameters, generator.queryParameters(op.query, "")...)
+	}
+	if parameters != nil {
+		result["parameters"] = parameters
+	}
+
+	if op.request != nil {
+		result["requestBody"] = object{
+			"required": true,
+			"content":  object{"application/json": object{"schema": generator.message(op.request)}},
+		}
+	}
+	if op.multipart {
+		result["requestBody"] = object{
+			"required": true,
+			"content": object{"multipart/form-data": object{"schema": object{
+				"type":       "object",
+				"required":   []string{"image"},
+				"properties": object{"image": object{"type": "string", "format": "binary"}},
+			}}},
+		}
+	}
+
+	return result
+}
+
+// queryParameters returns a parameter for every scalar field of the message, the fields of nested messages
+// being named with dots, such as `min_ram.unit`
+func (generator *generator) queryParameters(message protoreflect.MessageDescriptor, prefix string) []interface{} {
+	var parameters []interface{}
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		name := prefix + string(field.Name())
+		if field.Kind() == protoreflect.MessageKind {
+			parameters = append(parameters, generator.queryParameters(field.Message(), name+".")...)
+			continue
+		}
+
+		parameters = append(parameters, object{
+			"name":   name,
+			"in":     "query",
+			"schema": generator.field(field),
+		})
+	}
+	return parameters
+}
+
+// message returns a reference to the schema of the message, adding it and the schemas it references
+func (generator *generator) message(message protoreflect.MessageDescriptor) object {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		return object{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return object{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}
+	}
+
+	name := schemaName(message.FullName())
+	if _, ok := generator.schemas[name]; ok {
+		return reference(name)
+	}
+	// Added before its fields, which may reference it
+	schema := object{"type": "object"}
+	generator.schemas[name] = schema
+
+	properties := object{}
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		property := generator.field(field)
+		if field.IsList() {
+			property = object{"type": "array", "items": property}
+		}
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			property["description"] = "Only one of the fields of `" + string(oneof.Name()) + "` is set"
+		}
+		properties[string(field.Name())] = property
+	}
+	schema["properties"] = properties
+
+	return reference(name)
+}
+
+// field returns the schema of a single value of the field
+func (generator *generator) field(field protoreflect.FieldDescriptor) object {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return generator.message(field.Message())
+	case protoreflect.EnumKind:
+		return generator.enum(field.Enum())
+	case protoreflect.BoolKind:
+		return object{"type": "boolean"}
+	case protoreflect.StringKind:
+		return object{"type": "string"}
+	case protoreflect.BytesKind:
+		return object{"type": "string", "format": "byte"}
+	case protoreflect.DoubleKind:
+		return object{"type": "number", "format": "double"}
+	case protoreflect.FloatKind:
+		return object{"type": "number", "format": "float"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return object{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return object{"type": "integer", "format": "int64", "minimum": 0}
+	default:
+		// protojson encodes the 64-bit integers as strings
+		return object{"type": "string", "format": strings.ToLower(field.Kind().String())}
+	}
+}
+
+func (generator *generator) enum(enum protoreflect.EnumDescriptor) object {
+	name := schemaName(enum.FullName())
+	if _, ok := generator.schemas[name]; !ok {
+		values := enum.Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		generator.schemas[name] = object{"type": "string", "enum": names}
+	}
+	return reference(name)
+}
+
+// schemaName is the name of a message or an enum without the package, such as `Screen.Panel`
+func schemaName(fullName protoreflect.FullName) string {
+	return strings.TrimPrefix(string(fullName), string((&pb.Laptop{}).ProtoReflect().Descriptor().ParentFile().Package())+".")
+}
+
+func reference(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
@@ -0,0 +1,54 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecMatchesProtos(t *testing.T) {
+	t.Parallel()
+
+	spec, err := openapi.Generate()
+	require.NoError(t, err)
+	require.Equal(t, string(spec), string(openapi.Spec), "openapi.json is out of date with the protos, run `make openapi`")
+}
+
+func TestSpec(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	openapi.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, openapi.Path, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var document struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+			} `json:"parameters"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Enum       []string               `json:"enum"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+
+	require.Contains(t, document.Paths, "/v1/login")
+	var parameters []string
+	for _, parameter := range document.Paths["/v1/laptops"]["get"].Parameters {
+		parameters = append(parameters, parameter.Name)
+	}
+	require.Equal(t, []string{"max_price_usd", "min_cpu_cores", "min_cpu_ghz", "min_ram.value", "min_ram.unit"}, parameters)
+
+	require.Contains(t, document.Components.Schemas["Memory.Unit"].Enum, "GIGABYTE")
+	require.Contains(t, document.Components.Schemas["Laptop"].Properties, "weight_kg")
+	require.Contains(t, document.Components.Schemas, "Screen.Resolution")
+}
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.31.0
 // 	protoc        v3.12.4
 // source: laptop_service.proto
 
@@ -114,6 +114,100 @@ func (x *CreateLaptopResponse) GetId() string {
 	return ""
 }
 
+type UpdateLaptopRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Laptop *Laptop `protobuf:"bytes,1,opt,name=laptop,proto3" json:"laptop,omitempty"`
+}
+
+func (x *UpdateLaptopRequest) Reset() {
+	*x = UpdateLaptopRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_service_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UpdateLaptopRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateLaptopRequest) ProtoMessage() {}
+
+func (x *UpdateLaptopRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_service_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateLaptopRequest.ProtoReflect.Descriptor instead.
+func (*UpdateLaptopRequest) Descriptor() ([]byte, []int) {
+	return file_laptop_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UpdateLaptopRequest) GetLaptop() *Laptop {
+	if x != nil {
+		return x.Laptop
+	}
+	return nil
+}
+
+type UpdateLaptopResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *UpdateLaptopResponse) Reset() {
+	*x = UpdateLaptopResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_service_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UpdateLaptopResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateLaptopResponse) ProtoMessage() {}
+
+func (x *UpdateLaptopResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_service_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateLaptopResponse.ProtoReflect.Descriptor instead.
+func (*UpdateLaptopResponse) Descriptor() ([]byte, []int) {
+	return file_laptop_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UpdateLaptopResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
 type SearchLaptopRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -125,7 +219,7 @@ type SearchLaptopRequest struct {
 func (x *SearchLaptopRequest) Reset() {
 	*x = SearchLaptopRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[2]
+		mi := &file_laptop_service_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -138,7 +232,7 @@ func (x *SearchLaptopRequest) String() string {
 func (*SearchLaptopRequest) ProtoMessage() {}
 
 func (x *SearchLaptopRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[2]
+	mi := &file_laptop_service_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -151,7 +245,7 @@ func (x *SearchLaptopRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchLaptopRequest.ProtoReflect.Descriptor instead.
 func (*SearchLaptopRequest) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{2}
+	return file_laptop_service_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *SearchLaptopRequest) GetFilter() *Filter {
@@ -172,7 +266,7 @@ type SearchLaptopResponse struct {
 func (x *SearchLaptopResponse) Reset() {
 	*x = SearchLaptopResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[3]
+		mi := &file_laptop_service_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -185,7 +279,7 @@ func (x *SearchLaptopResponse) String() string {
 func (*SearchLaptopResponse) ProtoMessage() {}
 
 func (x *SearchLaptopResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[3]
+	mi := &file_laptop_service_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -198,7 +292,7 @@ func (x *SearchLaptopResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchLaptopResponse.ProtoReflect.Descriptor instead.
 func (*SearchLaptopResponse) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{3}
+	return file_laptop_service_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *SearchLaptopResponse) GetLaptop() *Laptop {
@@ -214,7 +308,6 @@ type UploadImageRequest struct {
 	unknownFields protoimpl.UnknownFields
 
 	// Types that are assignable to Data:
-	//
 	//	*UploadImageRequest_Info
 	//	*UploadImageRequest_ChunkData
 	Data isUploadImageRequest_Data `protobuf_oneof:"data"`
@@ -223,7 +316,7 @@ type UploadImageRequest struct {
 func (x *UploadImageRequest) Reset() {
 	*x = UploadImageRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[4]
+		mi := &file_laptop_service_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -236,7 +329,7 @@ func (x *UploadImageRequest) String() string {
 func (*UploadImageRequest) ProtoMessage() {}
 
 func (x *UploadImageRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[4]
+	mi := &file_laptop_service_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -249,7 +342,7 @@ func (x *UploadImageRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UploadImageRequest.ProtoReflect.Descriptor instead.
 func (*UploadImageRequest) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{4}
+	return file_laptop_service_proto_rawDescGZIP(), []int{6}
 }
 
 func (m *UploadImageRequest) GetData() isUploadImageRequest_Data {
@@ -301,7 +394,7 @@ type ImageInfo struct {
 func (x *ImageInfo) Reset() {
 	*x = ImageInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[5]
+		mi := &file_laptop_service_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -314,7 +407,7 @@ func (x *ImageInfo) String() string {
 func (*ImageInfo) ProtoMessage() {}
 
 func (x *ImageInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[5]
+	mi := &file_laptop_service_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -327,7 +420,7 @@ func (x *ImageInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ImageInfo.ProtoReflect.Descriptor instead.
 func (*ImageInfo) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{5}
+	return file_laptop_service_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ImageInfo) GetLaptopId() string {
@@ -356,7 +449,7 @@ type UploadImageResponse struct {
 func (x *UploadImageResponse) Reset() {
 	*x = UploadImageResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[6]
+		mi := &file_laptop_service_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -369,7 +462,7 @@ func (x *UploadImageResponse) String() string {
 func (*UploadImageResponse) ProtoMessage() {}
 
 func (x *UploadImageResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[6]
+	mi := &file_laptop_service_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -382,7 +475,7 @@ func (x *UploadImageResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UploadImageResponse.ProtoReflect.Descriptor instead.
 func (*UploadImageResponse) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{6}
+	return file_laptop_service_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *UploadImageResponse) GetId() string {
@@ -411,7 +504,7 @@ type RateLaptopRequest struct {
 func (x *RateLaptopRequest) Reset() {
 	*x = RateLaptopRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[7]
+		mi := &file_laptop_service_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -424,7 +517,7 @@ func (x *RateLaptopRequest) String() string {
 func (*RateLaptopRequest) ProtoMessage() {}
 
 func (x *RateLaptopRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[7]
+	mi := &file_laptop_service_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -437,7 +530,7 @@ func (x *RateLaptopRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RateLaptopRequest.ProtoReflect.Descriptor instead.
 func (*RateLaptopRequest) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{7}
+	return file_laptop_service_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *RateLaptopRequest) GetLaptopId() string {
@@ -467,7 +560,7 @@ type RateLaptopResponse struct {
 func (x *RateLaptopResponse) Reset() {
 	*x = RateLaptopResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_laptop_service_proto_msgTypes[8]
+		mi := &file_laptop_service_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -480,7 +573,7 @@ func (x *RateLaptopResponse) String() string {
 func (*RateLaptopResponse) ProtoMessage() {}
 
 func (x *RateLaptopResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_laptop_service_proto_msgTypes[8]
+	mi := &file_laptop_service_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -493,7 +586,7 @@ func (x *RateLaptopResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RateLaptopResponse.ProtoReflect.Descriptor instead.
 func (*RateLaptopResponse) Descriptor() ([]byte, []int) {
-	return file_laptop_service_proto_rawDescGZIP(), []int{8}
+	return file_laptop_service_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *RateLaptopResponse) GetLaptopId() string {
@@ -532,70 +625,83 @@ var file_laptop_service_proto_rawDesc = []byte{
 	0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x22, 0x26, 0x0a,
 	0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73,
 	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x47, 0x0a, 0x13, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c,
+	0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x47, 0x0a, 0x13, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4c,
 	0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x30, 0x0a, 0x06,
-	0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x65,
-	0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e,
-	0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x22, 0x48,
-	0x0a, 0x14, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x30, 0x0a, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61,
-	0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70,
-	0x52, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x22, 0x70, 0x0a, 0x12, 0x55, 0x70, 0x6c, 0x6f,
-	0x61, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x31,
-	0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x65,
+	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x65,
 	0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e,
-	0x49, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x48, 0x00, 0x52, 0x04, 0x69, 0x6e, 0x66,
-	0x6f, 0x12, 0x1f, 0x0a, 0x0a, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x09, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x44, 0x61,
-	0x74, 0x61, 0x42, 0x06, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x47, 0x0a, 0x09, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x70, 0x74, 0x6f,
-	0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61, 0x70, 0x74,
-	0x6f, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x79,
-	0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x54,
-	0x79, 0x70, 0x65, 0x22, 0x39, 0x0a, 0x13, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x49, 0x6d, 0x61,
-	0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69,
-	0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x22, 0x46,
-	0x0a, 0x11, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64,
-	0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52,
-	0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x22, 0x77, 0x0a, 0x12, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61,
-	0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1b, 0x0a, 0x09,
-	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x61, 0x74,
-	0x65, 0x64, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a,
-	0x72, 0x61, 0x74, 0x65, 0x64, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x23, 0x0a, 0x0d, 0x61, 0x76,
-	0x65, 0x72, 0x61, 0x67, 0x65, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x01, 0x52, 0x0c, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x32,
-	0x92, 0x03, 0x0a, 0x0d, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x12, 0x5f, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f,
-	0x70, 0x12, 0x25, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63,
-	0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f,
-	0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61,
-	0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x43, 0x72, 0x65, 0x61,
-	0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x22, 0x00, 0x12, 0x61, 0x0a, 0x0c, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74,
+	0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x22, 0x26,
+	0x0a, 0x14, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x47, 0x0a, 0x13, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68,
+	0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x30, 0x0a,
+	0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e,
+	0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b,
+	0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x22,
+	0x48, 0x0a, 0x14, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x30, 0x0a, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f,
+	0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e,
+	0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f,
+	0x70, 0x52, 0x06, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x22, 0x70, 0x0a, 0x12, 0x55, 0x70, 0x6c,
+	0x6f, 0x61, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x31, 0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e,
+	0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b,
+	0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x48, 0x00, 0x52, 0x04, 0x69, 0x6e,
+	0x66, 0x6f, 0x12, 0x1f, 0x0a, 0x0a, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x5f, 0x64, 0x61, 0x74, 0x61,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x09, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x44,
+	0x61, 0x74, 0x61, 0x42, 0x06, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x47, 0x0a, 0x09, 0x49,
+	0x6d, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x70, 0x74,
+	0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6d, 0x61, 0x67, 0x65,
+	0x54, 0x79, 0x70, 0x65, 0x22, 0x39, 0x0a, 0x13, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x49, 0x6d,
+	0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73,
+	0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x22,
+	0x46, 0x0a, 0x11, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49,
+	0x64, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x22, 0x77, 0x0a, 0x12, 0x52, 0x61, 0x74, 0x65, 0x4c,
+	0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1b, 0x0a,
+	0x09, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x61,
+	0x74, 0x65, 0x64, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0a, 0x72, 0x61, 0x74, 0x65, 0x64, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x23, 0x0a, 0x0d, 0x61,
+	0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x5f, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x0c, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x53, 0x63, 0x6f, 0x72, 0x65,
+	0x32, 0xf3, 0x03, 0x0a, 0x0d, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x12, 0x5f, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74,
 	0x6f, 0x70, 0x12, 0x25, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70,
-	0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74,
+	0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74,
 	0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x65, 0x73, 0x68, 0x61,
-	0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x53, 0x65, 0x61,
-	0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
-	0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x5e, 0x0a, 0x0b, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x49,
-	0x6d, 0x61, 0x67, 0x65, 0x12, 0x24, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67,
-	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x65, 0x73, 0x68,
+	0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x43, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x12, 0x5f, 0x0a, 0x0c, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x12, 0x25, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e,
+	0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x65, 0x73, 0x68,
 	0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x55, 0x70,
-	0x6c, 0x6f, 0x61, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
-	0x65, 0x22, 0x00, 0x28, 0x01, 0x12, 0x5d, 0x0a, 0x0a, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70,
-	0x74, 0x6f, 0x70, 0x12, 0x23, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e,
-	0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f,
-	0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61,
-	0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x52, 0x61, 0x74, 0x65,
-	0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
-	0x28, 0x01, 0x30, 0x01, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x2f, 0x2e, 0x2e, 0x2f, 0x67, 0x6f, 0x2f,
-	0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x64, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x12, 0x61, 0x0a, 0x0c, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61,
+	0x70, 0x74, 0x6f, 0x70, 0x12, 0x25, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61,
+	0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x65, 0x73,
+	0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x53,
+	0x65, 0x61, 0x72, 0x63, 0x68, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x5e, 0x0a, 0x0b, 0x55, 0x70, 0x6c, 0x6f, 0x61,
+	0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x24, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61,
+	0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64,
+	0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x65,
+	0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e,
+	0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x12, 0x5d, 0x0a, 0x0a, 0x52, 0x61, 0x74, 0x65, 0x4c,
+	0x61, 0x70, 0x74, 0x6f, 0x70, 0x12, 0x23, 0x2e, 0x65, 0x73, 0x68, 0x61, 0x61, 0x6e, 0x61, 0x67,
+	0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x65, 0x73, 0x68,
+	0x61, 0x61, 0x6e, 0x61, 0x67, 0x67, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x52, 0x61,
+	0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x2f, 0x2e, 0x2e, 0x2f, 0x67,
+	0x6f, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -610,38 +716,43 @@ func file_laptop_service_proto_rawDescGZIP() []byte {
 	return file_laptop_service_proto_rawDescData
 }
 
-var file_laptop_service_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_laptop_service_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_laptop_service_proto_goTypes = []interface{}{
 	(*CreateLaptopRequest)(nil),  // 0: eshaanagg.pcbook.CreateLaptopRequest
 	(*CreateLaptopResponse)(nil), // 1: eshaanagg.pcbook.CreateLaptopResponse
-	(*SearchLaptopRequest)(nil),  // 2: eshaanagg.pcbook.SearchLaptopRequest
-	(*SearchLaptopResponse)(nil), // 3: eshaanagg.pcbook.SearchLaptopResponse
-	(*UploadImageRequest)(nil),   // 4: eshaanagg.pcbook.UploadImageRequest
-	(*ImageInfo)(nil),            // 5: eshaanagg.pcbook.ImageInfo
-	(*UploadImageResponse)(nil),  // 6: eshaanagg.pcbook.UploadImageResponse
-	(*RateLaptopRequest)(nil),    // 7: eshaanagg.pcbook.RateLaptopRequest
-	(*RateLaptopResponse)(nil),   // 8: eshaanagg.pcbook.RateLaptopResponse
-	(*Laptop)(nil),               // 9: eshaanagg.pcbook.Laptop
-	(*Filter)(nil),               // 10: eshaanagg.pcbook.Filter
+	(*UpdateLaptopRequest)(nil),  // 2: eshaanagg.pcbook.UpdateLaptopRequest
+	(*UpdateLaptopResponse)(nil), // 3: eshaanagg.pcbook.UpdateLaptopResponse
+	(*SearchLaptopRequest)(nil),  // 4: eshaanagg.pcbook.SearchLaptopRequest
+	(*SearchLaptopResponse)(nil), // 5: eshaanagg.pcbook.SearchLaptopResponse
+	(*UploadImageRequest)(nil),   // 6: eshaanagg.pcbook.UploadImageRequest
+	(*ImageInfo)(nil),            // 7: eshaanagg.pcbook.ImageInfo
+	(*UploadImageResponse)(nil),  // 8: eshaanagg.pcbook.UploadImageResponse
+	(*RateLaptopRequest)(nil),    // 9: eshaanagg.pcbook.RateLaptopRequest
+	(*RateLaptopResponse)(nil),   // 10: eshaanagg.pcbook.RateLaptopResponse
+	(*Laptop)(nil),               // 11: eshaanagg.pcbook.Laptop
+	(*Filter)(nil),               // 12: eshaanagg.pcbook.Filter
 }
 var file_laptop_service_proto_depIdxs = []int32{
-	9,  // 0: eshaanagg.pcbook.CreateLaptopRequest.laptop:type_name -> eshaanagg.pcbook.Laptop
-	10, // 1: eshaanagg.pcbook.SearchLaptopRequest.filter:type_name -> eshaanagg.pcbook.Filter
-	9,  // 2: eshaanagg.pcbook.SearchLaptopResponse.laptop:type_name -> eshaanagg.pcbook.Laptop
-	5,  // 3: eshaanagg.pcbook.UploadImageRequest.info:type_name -> eshaanagg.pcbook.ImageInfo
-	0,  // 4: eshaanagg.pcbook.LaptopService.CreateLaptop:input_type -> eshaanagg.pcbook.CreateLaptopRequest
-	2,  // 5: eshaanagg.pcbook.LaptopService.SearchLaptop:input_type -> eshaanagg.pcbook.SearchLaptopRequest
-	4,  // 6: eshaanagg.pcbook.LaptopService.UploadImage:input_type -> eshaanagg.pcbook.UploadImageRequest
-	7,  // 7: eshaanagg.pcbook.LaptopService.RateLaptop:input_type -> eshaanagg.pcbook.RateLaptopRequest
-	1,  // 8: eshaanagg.pcbook.LaptopService.CreateLaptop:output_type -> eshaanagg.pcbook.CreateLaptopResponse
-	3,  // 9: eshaanagg.pcbook.LaptopService.SearchLaptop:output_type -> eshaanagg.pcbook.SearchLaptopResponse
-	6,  // 10: eshaanagg.pcbook.LaptopService.UploadImage:output_type -> eshaanagg.pcbook.UploadImageResponse
-	8,  // 11: eshaanagg.pcbook.LaptopService.RateLaptop:output_type -> eshaanagg.pcbook.RateLaptopResponse
-	8,  // [8:12] is the sub-list for method output_type
-	4,  // [4:8] is the sub-list for method input_type
-	4,  // [4:4] is the sub-list for extension type_name
-	4,  // [4:4] is the sub-list for extension extendee
-	0,  // [0:4] is the sub-list for field type_name
+	11, // 0: eshaanagg.pcbook.CreateLaptopRequest.laptop:type_name -> eshaanagg.pcbook.Laptop
+	11, // 1: eshaanagg.pcbook.UpdateLaptopRequest.laptop:type_name -> eshaanagg.pcbook.Laptop
+	12, // 2: eshaanagg.pcbook.SearchLaptopRequest.filter:type_name -> eshaanagg.pcbook.Filter
+	11, // 3: eshaanagg.pcbook.SearchLaptopResponse.laptop:type_name -> eshaanagg.pcbook.Laptop
+	7,  // 4: eshaanagg.pcbook.UploadImageRequest.info:type_name -> eshaanagg.pcbook.ImageInfo
+	0,  // 5: eshaanagg.pcbook.LaptopService.CreateLaptop:input_type -> eshaanagg.pcbook.CreateLaptopRequest
+	2,  // 6: eshaanagg.pcbook.LaptopService.UpdateLaptop:input_type -> eshaanagg.pcbook.UpdateLaptopRequest
+	4,  // 7: eshaanagg.pcbook.LaptopService.SearchLaptop:input_type -> eshaanagg.pcbook.SearchLaptopRequest
+	6,  // 8: eshaanagg.pcbook.LaptopService.UploadImage:input_type -> eshaanagg.pcbook.UploadImageRequest
+	9,  // 9: eshaanagg.pcbook.LaptopService.RateLaptop:input_type -> eshaanagg.pcbook.RateLaptopRequest
+	1,  // 10: eshaanagg.pcbook.LaptopService.CreateLaptop:output_type -> eshaanagg.pcbook.CreateLaptopResponse
+	3,  // 11: eshaanagg.pcbook.LaptopService.UpdateLaptop:output_type -> eshaanagg.pcbook.UpdateLaptopResponse
+	5,  // 12: eshaanagg.pcbook.LaptopService.SearchLaptop:output_type -> eshaanagg.pcbook.SearchLaptopResponse
+	8,  // 13: eshaanagg.pcbook.LaptopService.UploadImage:output_type -> eshaanagg.pcbook.UploadImageResponse
+	10, // 14: eshaanagg.pcbook.LaptopService.RateLaptop:output_type -> eshaanagg.pcbook.RateLaptopResponse
+	10, // [10:15] is the sub-list for method output_type
+	5,  // [5:10] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_laptop_service_proto_init() }
@@ -677,7 +788,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SearchLaptopRequest); i {
+			switch v := v.(*UpdateLaptopRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -689,7 +800,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SearchLaptopResponse); i {
+			switch v := v.(*UpdateLaptopResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -701,7 +812,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UploadImageRequest); i {
+			switch v := v.(*SearchLaptopRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -713,7 +824,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ImageInfo); i {
+			switch v := v.(*SearchLaptopResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -725,7 +836,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UploadImageResponse); i {
+			switch v := v.(*UploadImageRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -737,7 +848,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*RateLaptopRequest); i {
+			switch v := v.(*ImageInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -749,6 +860,30 @@ func file_laptop_service_proto_init() {
 			}
 		}
 		file_laptop_service_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UploadImageResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_laptop_service_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateLaptopRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_laptop_service_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*RateLaptopResponse); i {
 			case 0:
 				return &v.state
@@ -761,7 +896,7 @@ func file_laptop_service_proto_init() {
 			}
 		}
 	}
-	file_laptop_service_proto_msgTypes[4].OneofWrappers = []interface{}{
+	file_laptop_service_proto_msgTypes[6].OneofWrappers = []interface{}{
 		(*UploadImageRequest_Info)(nil),
 		(*UploadImageRequest_ChunkData)(nil),
 	}
@@ -771,7 +906,7 @@ func file_laptop_service_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_laptop_service_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   9,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
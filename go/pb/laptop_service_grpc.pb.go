@@ -23,6 +23,7 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LaptopServiceClient interface {
 	CreateLaptop(ctx context.Context, in *CreateLaptopRequest, opts ...grpc.CallOption) (*CreateLaptopResponse, error)
+	UpdateLaptop(ctx context.Context, in *UpdateLaptopRequest, opts ...grpc.CallOption) (*UpdateLaptopResponse, error)
 	SearchLaptop(ctx context.Context, in *SearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_SearchLaptopClient, error)
 	UploadImage(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadImageClient, error)
 	RateLaptop(ctx context.Context, opts ...grpc.CallOption) (LaptopService_RateLaptopClient, error)
@@ -45,6 +46,15 @@ func (c *laptopServiceClient) CreateLaptop(ctx context.Context, in *CreateLaptop
 	return out, nil
 }
 
+func (c *laptopServiceClient) UpdateLaptop(ctx context.Context, in *UpdateLaptopRequest, opts ...grpc.CallOption) (*UpdateLaptopResponse, error) {
+	out := new(UpdateLaptopResponse)
+	err := c.cc.Invoke(ctx, "/eshaanagg.pcbook.LaptopService/UpdateLaptop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *laptopServiceClient) SearchLaptop(ctx context.Context, in *SearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_SearchLaptopClient, error) {
 	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[0], "/eshaanagg.pcbook.LaptopService/SearchLaptop", opts...)
 	if err != nil {
@@ -147,6 +157,7 @@ func (x *laptopServiceRateLaptopClient) Recv() (*RateLaptopResponse, error) {
 // for forward compatibility
 type LaptopServiceServer interface {
 	CreateLaptop(context.Context, *CreateLaptopRequest) (*CreateLaptopResponse, error)
+	UpdateLaptop(context.Context, *UpdateLaptopRequest) (*UpdateLaptopResponse, error)
 	SearchLaptop(*SearchLaptopRequest, LaptopService_SearchLaptopServer) error
 	UploadImage(LaptopService_UploadImageServer) error
 	RateLaptop(LaptopService_RateLaptopServer) error
@@ -160,6 +171,9 @@ type UnimplementedLaptopServiceServer struct {
 func (UnimplementedLaptopServiceServer) CreateLaptop(context.Context, *CreateLaptopRequest) (*CreateLaptopResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateLaptop not implemented")
 }
+func (UnimplementedLaptopServiceServer) UpdateLaptop(context.Context, *UpdateLaptopRequest) (*UpdateLaptopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLaptop not implemented")
+}
 func (UnimplementedLaptopServiceServer) SearchLaptop(*SearchLaptopRequest, LaptopService_SearchLaptopServer) error {
 	return status.Errorf(codes.Unimplemented, "method SearchLaptop not implemented")
 }
@@ -200,6 +214,24 @@ func _LaptopService_CreateLaptop_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _LaptopService_UpdateLaptop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLaptopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).UpdateLaptop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eshaanagg.pcbook.LaptopService/UpdateLaptop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).UpdateLaptop(ctx, req.(*UpdateLaptopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _LaptopService_SearchLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(SearchLaptopRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -284,6 +316,10 @@ var LaptopService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateLaptop",
 			Handler:    _LaptopService_CreateLaptop_Handler,
 		},
+		{
+			MethodName: "UpdateLaptop",
+			Handler:    _LaptopService_UpdateLaptop_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
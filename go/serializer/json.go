@@ -5,15 +5,18 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// JSONOptions are the protojson settings of the JSON files and of the HTTP gateway
+var JSONOptions = protojson.MarshalOptions{
+	UseEnumNumbers:  false,
+	EmitUnpopulated: true,
+	UseProtoNames:   true,
+}
+
 // ProtobufToJSON converts protocol buffer message to JSON string
 func ProtobufToJSON(message proto.Message) (string, error) {
-	marshaler := protojson.MarshalOptions{
-		UseEnumNumbers:  false,
-		EmitUnpopulated: true,
-		Indent:          "  ",
-		UseProtoNames:   true,
-		Multiline:       true,
-	}
+	marshaler := JSONOptions
+	marshaler.Indent = "  "
+	marshaler.Multiline = true
 
 	msg, err := marshaler.Marshal(message)
 	return string(msg), err
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type APIKeyStore interface {
+	Save(key *APIKey) error
+	Find(id string) (*APIKey, error)
+	List() ([]*APIKey, error)
+	Revoke(id string, revokedAt time.Time) error
+	// Touch records the last time the key was used
+	Touch(id string, usedAt time.Time) error
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
+}
+
+// InMemoryAPIKeyStore stores API keys in memory
+type InMemoryAPIKeyStore struct {
+	mutex sync.RWMutex
+	keys  map[string]*APIKey
+}
+
+// NewInMemoryAPIKeyStore returns a new in-memory API key store
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{
+		keys: make(map[string]*APIKey),
+	}
+}
+
+func (store *InMemoryAPIKeyStore) Save(key *APIKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.keys[key.ID] != nil {
+		return ErrAlreadyExists
+	}
+
+	store.keys[key.ID] = key.Clone()
+	return nil
+}
+
+func (store *InMemoryAPIKeyStore) Find(id string) (*APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return nil, nil
+	}
+
+	return key.Clone(), nil
+}
+
+// List returns all the keys, including the revoked and expired ones, ordered by creation time
+func (store *InMemoryAPIKeyStore) List() ([]*APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys := make([]*APIKey, 0, len(store.keys))
+	for _, key := range store.keys {
+		keys = append(keys, key.Clone())
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (store *InMemoryAPIKeyStore) Revoke(id string, revokedAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return ErrNotFound
+	}
+
+	if key.RevokedAt.IsZero() {
+		key.RevokedAt = revokedAt
+	}
+	return nil
+}
+
+func (store *InMemoryAPIKeyStore) Touch(id string, usedAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := store.keys[id]
+	if key == nil {
+		return ErrNotFound
+	}
+
+	if usedAt.After(key.LastUsedAt) {
+		key.LastUsedAt = usedAt
+	}
+	return nil
+}
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryAPIKeyStore) HealthCheck() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	t.Parallel()
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	apiKeyStore := service.NewInMemoryAPIKeyStore()
+	authServer := service.NewAuthServer(service.NewInMemoryUserStore(), service.NewInMemoryTenantStore(), apiKeyStore, nil, jwtManager, nil, policy)
+	interceptor := service.NewAuthInterceptor(jwtManager, apiKeyStore, nil, policy, nil)
+
+	admin := service.ContextWithUser(context.Background(), &service.User{Username: "admin1", Role: "admin"})
+	_, err = authServer.CreateAPIKey(admin, &pb.CreateAPIKeyRequest{Name: "typo", Role: "admn"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := authServer.CreateAPIKey(admin, &pb.CreateAPIKeyRequest{
+		Name:    "import-job",
+		Role:    "admin",
+		Methods: []string{"/eshaanagg.pcbook.LaptopService/CreateLaptop"},
+		Ttl:     durationpb.New(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "admin1", res.GetKey().GetCreatedBy())
+	require.NotNil(t, res.GetKey().GetExpiresAt())
+
+	call := func(apiKey string, method string) (*service.User, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+		var user *service.User
+		_, err := interceptor.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			user, _ = service.UserFromContext(ctx)
+			return nil, nil
+		})
+		return user, err
+	}
+
+	user, err := call(res.GetSecret(), "/eshaanagg.pcbook.LaptopService/CreateLaptop")
+	require.NoError(t, err)
+	require.Equal(t, "admin", user.Role)
+
+	keys, err := authServer.ListAPIKeys(admin, &pb.ListAPIKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, keys.GetKeys(), 1)
+	require.NotNil(t, keys.GetKeys()[0].GetLastUsedAt())
+
+	_, err = call(res.GetSecret(), "/eshaanagg.pcbook.LaptopService/UploadImage")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = call(res.GetSecret()+"x", "/eshaanagg.pcbook.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// An invalid API key is rejected even by the methods that can be called anonymously
+	_, err = call(res.GetSecret()+"x", "/eshaanagg.pcbook.AuthService/Login")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	user, err = func() (*service.User, error) {
+		var user *service.User
+		_, err := interceptor.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/eshaanagg.pcbook.AuthService/Login"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			user, _ = service.UserFromContext(ctx)
+			return nil, nil
+		})
+		return user, err
+	}()
+	require.NoError(t, err)
+	require.Nil(t, user)
+
+	_, err = authServer.RevokeAPIKey(admin, &pb.RevokeAPIKeyRequest{Id: res.GetKey().GetId()})
+	require.NoError(t, err)
+
+	_, err = call(res.GetSecret(), "/eshaanagg.pcbook.LaptopService/CreateLaptop")
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = authServer.RevokeAPIKey(admin, &pb.RevokeAPIKeyRequest{Id: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	t.Parallel()
+
+	key, secret, err := service.NewAPIKey("ci", "user", service.DefaultTenantID, nil, time.Minute, "admin1")
+	require.NoError(t, err)
+
+	id, parsedSecret, err := service.ParseAPIKey(secret)
+	require.NoError(t, err)
+	require.Equal(t, key.ID, id)
+	require.True(t, key.IsCorrectSecret(parsedSecret))
+	require.NotContains(t, key.HashedSecret, parsedSecret)
+
+	require.True(t, key.IsActive(time.Now()))
+	require.False(t, key.IsActive(time.Now().Add(2*time.Minute)))
+	require.True(t, key.AllowsMethod("/eshaanagg.pcbook.LaptopService/RateLaptop"))
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+)
+
+// Types of audit events
+const (
+	AuditLoginSuccess = "login.success"
+	AuditLoginFailure = "login.failure"
+	// AuditTokenRefresh is a login of a user who already holds a valid token, which is how clients refresh their token
+	AuditTokenRefresh  = "token.refresh"
+	AuditAccessDenied  = "access.denied"
+	AuditRPCMutation   = "rpc.mutation"
+	auditOutcomeOK     = "success"
+	auditOutcomeFailed = "failure"
+)
+
+// AuditEvent is a security relevant action, written as one JSON line of the audit log
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Username string    `json:"username,omitempty"`
+	Role     string    `json:"role,omitempty"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	Peer     string    `json:"peer,omitempty"`
+	Method   string    `json:"method"`
+	LaptopID string    `json:"laptop_id,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Code     string    `json:"code"`
+}
+
+// AuditFilter selects audit events. Empty fields match every event.
+type AuditFilter struct {
+	Username string
+	Method   string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (filter *AuditFilter) matches(event *AuditEvent) bool {
+	return (filter.Username == "" || event.Username == filter.Username) &&
+		(filter.Method == "" || event.Method == filter.Method) &&
+		(filter.Since.IsZero() || !event.Time.Before(filter.Since)) &&
+		(filter.Until.IsZero() || event.Time.Before(filter.Until))
+}
+
+type AuditLog interface {
+	Record(event *AuditEvent) error
+	// Query returns the matching events, oldest first
+	Query(filter AuditFilter) ([]*AuditEvent, error)
+}
+
+const (
+	auditFileName   = "audit.log"
+	auditFilePrefix = "audit-"
+	// auditTimeFormat names the rotated files so that they sort chronologically
+	auditTimeFormat = "20060102T150405.000000000"
+)
+
+// FileAuditLog appends audit events as JSON lines to a file in a directory.
+// The file is rotated once it grows over a maximum size, and only the most recent rotated files are kept.
+type FileAuditLog struct {
+	mutex    sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewFileAuditLog opens the audit log in a directory. maxFiles is the number of rotated files to keep, zero keeps all of them.
+func NewFileAuditLog(dir string, maxSize int64, maxFiles int) (*FileAuditLog, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create audit log directory: %w", err)
+	}
+
+	auditLog := &FileAuditLog{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+
+	err = auditLog.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return auditLog, nil
+}
+
+// open opens the current file for appending. The caller must hold the mutex.
+func (auditLog *FileAuditLog) open() error {
+	file, err := os.OpenFile(filepath.Join(auditLog.dir, auditFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat audit log: %w", err)
+	}
+
+	auditLog.file = file
+	auditLog.size = info.Size()
+	return nil
+}
+
+func (auditLog *FileAuditLog) Record(event *AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+
+	if auditLog.size > 0 && auditLog.size+int64(len(line)) > auditLog.maxSize {
+		err = auditLog.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := auditLog.file.Write(line)
+	auditLog.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("cannot write audit event: %w", err)
+	}
+
+	return nil
+}
+
+// rotate renames the current file with a timestamp, starts a new one and deletes the oldest rotated files.
+// The caller must hold the mutex.
+func (auditLog *FileAuditLog) rotate() error {
+	err := auditLog.file.Close()
+	if err != nil {
+		return fmt.Errorf("cannot close audit log: %w", err)
+	}
+
+	rotated := filepath.Join(auditLog.dir, auditFilePrefix+time.Now().UTC().Format(auditTimeFormat)+".log")
+	err = os.Rename(filepath.Join(auditLog.dir, auditFileName), rotated)
+	if err != nil {
+		return fmt.Errorf("cannot rotate audit log: %w", err)
+	}
+
+	err = auditLog.open()
+	if err != nil {
+		return err
+	}
+
+	files, err := auditLog.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	for auditLog.maxFiles > 0 && len(files) > auditLog.maxFiles {
+		err = os.Remove(files[0])
+		if err != nil {
+			return fmt.Errorf("cannot delete old audit log: %w", err)
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+// rotatedFiles returns the paths of the rotated files, oldest first
+func (auditLog *FileAuditLog) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(auditLog.dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list audit logs: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), auditFilePrefix) && strings.HasSuffix(entry.Name(), ".log") {
+			files = append(files, filepath.Join(auditLog.dir, entry.Name()))
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func (auditLog *FileAuditLog) Query(filter AuditFilter) ([]*AuditEvent, error) {
+	files, err := auditLog.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	// The files are read without the mutex, so that the events are still recorded meanwhile
+	events := []*AuditEvent{}
+	for _, file := range files {
+		events, err = readAuditEvents(file, filter, events)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// auditFile is an audit log file opened for reading
+type auditFile struct {
+	*os.File
+	// size is the size of the file when it was opened, as the current file keeps growing
+	size int64
+}
+
+// openFiles opens the rotated files and the current file, oldest first. They are opened under the mutex
+// so that a rotation cannot move them in between, and the open files can still be read after a rotation.
+func (auditLog *FileAuditLog) openFiles() ([]*auditFile, error) {
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+
+	filenames, err := auditLog.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	filenames = append(filenames, filepath.Join(auditLog.dir, auditFileName))
+
+	files := make([]*auditFile, 0, len(filenames))
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err == nil {
+			var info os.FileInfo
+			info, err = file.Stat()
+			if err == nil {
+				files = append(files, &auditFile{File: file, size: info.Size()})
+				continue
+			}
+			file.Close()
+		}
+
+		for _, file := range files {
+			file.Close()
+		}
+		return nil, fmt.Errorf("cannot open audit log: %w", err)
+	}
+
+	return files, nil
+}
+
+func readAuditEvents(file *auditFile, filter AuditFilter, events []*AuditEvent) ([]*AuditEvent, error) {
+	// The events recorded after the file was opened are left out, as the last one may still be written
+	scanner := bufio.NewScanner(io.LimitReader(file, file.size))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		event := &AuditEvent{}
+		err := json.Unmarshal(scanner.Bytes(), event)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse audit event in %s: %w", file.Name(), err)
+		}
+		if filter.matches(event) {
+			events = append(events, event)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read audit log %s: %w", file.Name(), err)
+	}
+
+	return events, nil
+}
+
+// Close closes the current file of the audit log
+func (auditLog *FileAuditLog) Close() error {
+	auditLog.mutex.Lock()
+	defer auditLog.mutex.Unlock()
+
+	return auditLog.file.Close()
+}
+
+// mutatingPrefixes are the prefixes of the names of the methods that change the state of the server
+var mutatingPrefixes = []string{"Create", "Update", "Upload", "Rate", "Revoke", "Unlock", "Delete"}
+
+func isMutatingMethod(method string) bool {
+	name := method[strings.LastIndex(method, "/")+1:]
+	for _, prefix := range mutatingPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// laptopIDOf returns the ID of the laptop a request or response refers to, if any
+func laptopIDOf(message interface{}) string {
+	switch m := message.(type) {
+	case interface{ GetLaptop() *pb.Laptop }:
+		return m.GetLaptop().GetId()
+	case interface{ GetLaptopId() string }:
+		return m.GetLaptopId()
+	case *pb.UploadImageRequest:
+		return m.GetInfo().GetLaptopId()
+	case *pb.CreateLaptopResponse:
+		return m.GetId()
+	case *pb.UpdateLaptopResponse:
+		return m.GetId()
+	}
+
+	return ""
+}
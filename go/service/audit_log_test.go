@@ -0,0 +1,194 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuditLogRotation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	auditLog, err := service.NewFileAuditLog(dir, 300, 2)
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	start := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		err = auditLog.Record(&service.AuditEvent{
+			Time:     start.Add(time.Duration(i) * time.Second),
+			Type:     service.AuditRPCMutation,
+			Username: "vendor1",
+			Method:   "/eshaanagg.pcbook.LaptopService/CreateLaptop",
+			Outcome:  "success",
+			Code:     "OK",
+		})
+		require.NoError(t, err)
+	}
+
+	// Only the current file and the two most recent rotated files are kept
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	events, err := auditLog.Query(service.AuditFilter{})
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	require.Less(t, len(events), 10)
+	require.Equal(t, start.Add(9*time.Second), events[len(events)-1].Time)
+
+	events, err = auditLog.Query(service.AuditFilter{Since: start.Add(8 * time.Second)})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	events, err = auditLog.Query(service.AuditFilter{Username: "vendor2"})
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestAuditLogQueryWhileRecording(t *testing.T) {
+	t.Parallel()
+
+	auditLog, err := service.NewFileAuditLog(t.TempDir(), 500, 0)
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	// The events keep being recorded and rotated while the log is queried
+	start := time.Now().UTC()
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 200; i++ {
+			err := auditLog.Record(&service.AuditEvent{
+				Time:    start.Add(time.Duration(i) * time.Second),
+				Type:    service.AuditRPCMutation,
+				Method:  "/eshaanagg.pcbook.LaptopService/CreateLaptop",
+				Outcome: "success",
+				Code:    "OK",
+			})
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for recording := true; recording; {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			recording = false
+		default:
+		}
+
+		events, err := auditLog.Query(service.AuditFilter{})
+		require.NoError(t, err)
+		for i, event := range events {
+			require.Equal(t, start.Add(time.Duration(i)*time.Second), event.Time)
+		}
+	}
+
+	events, err := auditLog.Query(service.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 200)
+}
+
+func TestAuditInterceptor(t *testing.T) {
+	t.Parallel()
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+
+	auditLog, err := service.NewFileAuditLog(t.TempDir(), 1<<20, 0)
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	userStore := service.NewInMemoryUserStore()
+	require.NoError(t, service.CreateUser(userStore, "admin1", "secret", "admin", service.DefaultTenantID))
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	authServer := service.NewAuthServer(userStore, nil, nil, nil, jwtManager, auditLog, nil)
+	laptopServer := service.NewLaptopServer(service.NewInMemoryLaptopStore(), nil, nil, service.DefaultMaxImageSize, nil)
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, auditLog)
+
+	call := func(token string, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", token))
+		}
+		return interceptor.Unary()(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+	login := func(token string, password string) (string, error) {
+		res, err := call(token, "/eshaanagg.pcbook.AuthService/Login", &pb.LoginRequest{Username: "admin1", Password: password},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return authServer.Login(ctx, req.(*pb.LoginRequest))
+			})
+		if err != nil {
+			return "", err
+		}
+		return res.(*pb.LoginResponse).GetAccessToken(), nil
+	}
+
+	_, err = login("", "wrong")
+	require.Error(t, err)
+	token, err := login("", "secret")
+	require.NoError(t, err)
+	_, err = login(token, "secret")
+	require.NoError(t, err)
+
+	laptop := sample.NewLaptop()
+	_, err = call(token, "/eshaanagg.pcbook.LaptopService/CreateLaptop", &pb.CreateLaptopRequest{Laptop: laptop},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return laptopServer.CreateLaptop(ctx, req.(*pb.CreateLaptopRequest))
+		})
+	require.NoError(t, err)
+
+	userToken, err := jwtManager.Generate(&service.User{Username: "user1", Role: "user", TenantID: service.DefaultTenantID})
+	require.NoError(t, err)
+	_, err = call(userToken, "/eshaanagg.pcbook.LaptopService/CreateLaptop", &pb.CreateLaptopRequest{Laptop: sample.NewLaptop()}, nil)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	superAdmin := service.ContextWithUser(context.Background(), &service.User{Username: "root", Role: service.RoleSuperAdmin, TenantID: service.DefaultTenantID})
+	res, err := authServer.QueryAuditLog(superAdmin, &pb.QueryAuditLogRequest{})
+	require.NoError(t, err)
+
+	// The most recent events come first
+	events := res.GetEvents()
+	require.Len(t, events, 5)
+	require.Equal(t, service.AuditAccessDenied, events[0].GetType())
+	require.Equal(t, "user1", events[0].GetUsername())
+	require.Equal(t, "PermissionDenied", events[0].GetCode())
+	require.Equal(t, service.AuditRPCMutation, events[1].GetType())
+	require.Equal(t, laptop.Id, events[1].GetLaptopId())
+	require.Equal(t, "admin", events[1].GetRole())
+	require.Equal(t, service.AuditTokenRefresh, events[2].GetType())
+	require.Equal(t, service.AuditLoginSuccess, events[3].GetType())
+	require.Equal(t, "admin", events[3].GetRole())
+	require.Equal(t, service.AuditLoginFailure, events[4].GetType())
+	require.Equal(t, "failure", events[4].GetOutcome())
+
+	res, err = authServer.QueryAuditLog(superAdmin, &pb.QueryAuditLogRequest{Username: "admin1", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, res.GetEvents(), 2)
+
+	// Admins only see the events of their tenant, which excludes failed logins
+	admin := service.ContextWithUser(context.Background(), &service.User{Username: "admin1", Role: "admin", TenantID: service.DefaultTenantID})
+	res, err = authServer.QueryAuditLog(admin, &pb.QueryAuditLogRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.GetEvents(), 4)
+
+	other := service.ContextWithUser(context.Background(), &service.User{Username: "admin2", Role: "admin", TenantID: "other"})
+	res, err = authServer.QueryAuditLog(other, &pb.QueryAuditLogRequest{})
+	require.NoError(t, err)
+	require.Empty(t, res.GetEvents())
+}
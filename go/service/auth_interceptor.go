@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"time"
 
+	"github.com/eshaanagg/pcbook/go/pb"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -12,12 +15,18 @@ import (
 
 // AuthInterceptor is a server interceptor for authentication and authorization
 type AuthInterceptor struct {
-	jwtManager      *JWTManager
-	accessibleRoles map[string][]string
+	jwtManager *JWTManager
+	// apiKeyStore is nil if authentication with API keys is disabled
+	apiKeyStore APIKeyStore
+	// certMapper is nil if authentication with client certificates is disabled
+	certMapper *CertificateMapper
+	policy     PolicyProvider
+	// auditLog is nil if auditing is disabled
+	auditLog AuditLog
 }
 
-func NewAuthInterceptor(jwtManager *JWTManager, accessibleRoles map[string][]string) *AuthInterceptor {
-	return &AuthInterceptor{jwtManager, accessibleRoles}
+func NewAuthInterceptor(jwtManager *JWTManager, apiKeyStore APIKeyStore, certMapper *CertificateMapper, policy PolicyProvider, auditLog AuditLog) *AuthInterceptor {
+	return &AuthInterceptor{jwtManager, apiKeyStore, certMapper, policy, auditLog}
 }
 
 // Unary returns a server interceptor function to authenticate and authorize unary RPC
@@ -28,14 +37,21 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		log.Println("--> Unary interceptor: ", info.FullMethod)
+		slog.DebugContext(ctx, "Unary interceptor", "method", info.FullMethod)
 
-		err := interceptor.authorize(ctx, info.FullMethod)
+		user, err := interceptor.authorize(ctx, info.FullMethod)
 		if err != nil {
+			interceptor.audit(ctx, info.FullMethod, user, req, nil, laptopIDOf(req), err)
 			return nil, err
 		}
 
-		return handler(ctx, req)
+		res, err := handler(ContextWithUser(ctx, user), req)
+		laptopID := laptopIDOf(req)
+		if laptopID == "" {
+			laptopID = laptopIDOf(res)
+		}
+		interceptor.audit(ctx, info.FullMethod, user, req, res, laptopID, err)
+		return res, err
 	}
 }
 
@@ -47,45 +63,210 @@ func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
 	) error {
-		log.Println("--> Stream interceptor: ", info.FullMethod)
+		slog.DebugContext(stream.Context(), "Stream interceptor", "method", info.FullMethod)
 
-		err := interceptor.authorize(stream.Context(), info.FullMethod)
+		user, err := interceptor.authorize(stream.Context(), info.FullMethod)
 		if err != nil {
+			interceptor.audit(stream.Context(), info.FullMethod, user, nil, nil, "", err)
 			return err
 		}
 
-		return handler(srv, stream)
+		wrapped := &authenticatedStream{ServerStream: stream, ctx: ContextWithUser(stream.Context(), user)}
+		err = handler(srv, wrapped)
+		interceptor.audit(stream.Context(), info.FullMethod, user, nil, nil, wrapped.laptopID, err)
+		return err
 	}
 }
 
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
-	accessibleRoles, ok := interceptor.accessibleRoles[method]
-	if !ok {
-		// Everyone can access these non listed methods
-		return nil
+// authorize returns the authenticated user, which is nil for anonymous calls.
+// The user is also returned along with the error when the call is denied by the policy.
+// Methods that can be called anonymously still pick up the credentials, so that they are scoped to the tenant
+// of the caller: the call is only anonymous if no token or API key was sent, and fails if they are invalid.
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (*User, error) {
+	policy := interceptor.policy.Policy()
+	if policy.IsAnonymous(method) {
+		user, err := interceptor.authenticate(ctx, method)
+		if err != nil && interceptor.hasCredentials(ctx) {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	user, err := interceptor.authenticate(ctx, method)
+	if err != nil {
+		return nil, err
 	}
 
-	metadata, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return status.Errorf(codes.Unauthenticated, "Metadata is not provided in the request")
+	if policy.Allows(user.Role, method) {
+		return user, nil
+	}
+
+	return user, status.Error(codes.PermissionDenied, "no permission to access this RPC")
+}
+
+// authenticate returns the user identified by the `x-api-key` or the `authorization` metadata of the request,
+// or else by the verified client certificate of the connection
+func (interceptor *AuthInterceptor) authenticate(ctx context.Context, method string) (*User, error) {
+	metadata, _ := metadata.FromIncomingContext(ctx)
+
+	if values := metadata["x-api-key"]; len(values) > 0 && interceptor.apiKeyStore != nil {
+		return interceptor.authenticateAPIKey(values[0], method)
 	}
 
 	values := metadata["authorization"]
 	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "Authorization token is not provided in the request")
+		if certificate := verifiedClientCertificate(ctx); certificate != nil && interceptor.certMapper != nil {
+			user, err := interceptor.certMapper.UserFromCertificate(certificate)
+			if err != nil {
+				return nil, status.Errorf(codes.Unauthenticated, "Client certificate is invalid: %v", err)
+			}
+			return user, nil
+		}
+
+		return nil, status.Errorf(codes.Unauthenticated, "Authorization token is not provided in the request")
 	}
 
 	accessToken := values[0]
+	// The span is only recorded when the RPC is traced
+	_, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "JWTManager.Verify")
 	user, err := interceptor.jwtManager.Verify(accessToken)
+	endSpan(span, err)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Access token is invalid: %v", err)
+	}
+
+	return user, nil
+}
+
+// hasCredentials reports whether the request carries a token or an API key that authenticate checks
+func (interceptor *AuthInterceptor) hasCredentials(ctx context.Context) bool {
+	metadata, _ := metadata.FromIncomingContext(ctx)
+	if len(metadata["x-api-key"]) > 0 && interceptor.apiKeyStore != nil {
+		return true
+	}
+	return len(metadata["authorization"]) > 0
+}
+
+func (interceptor *AuthInterceptor) authenticateAPIKey(apiKey string, method string) (*User, error) {
+	id, secret, err := ParseAPIKey(apiKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "API key is invalid: %v", err)
+	}
+
+	key, err := interceptor.apiKeyStore.Find(id)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot find API key")
+	}
+
+	now := time.Now()
+	if key == nil || !key.IsCorrectSecret(secret) || !key.IsActive(now) {
+		return nil, status.Errorf(codes.Unauthenticated, "API key is invalid, expired or revoked")
+	}
+
+	if !key.AllowsMethod(method) {
+		return nil, status.Error(codes.PermissionDenied, "the API key is not scoped to this RPC")
+	}
+
+	err = interceptor.apiKeyStore.Touch(id, now)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "Access token is invalid: %v", err)
+		slog.Warn("Cannot record the last use of the API key", "api_key_id", id, "error", err)
+	}
+
+	return key.Principal(), nil
+}
+
+const loginMethod = "/eshaanagg.pcbook.AuthService/Login"
+
+// audit records logins, denied calls and mutating calls to the audit log.
+// The request and response are only given for unary calls.
+func (interceptor *AuthInterceptor) audit(ctx context.Context, method string, user *User, req interface{}, res interface{}, laptopID string, err error) {
+	if interceptor.auditLog == nil {
+		return
 	}
 
-	for _, role := range accessibleRoles {
-		if role == user.Role {
-			return nil
+	code := status.Code(err)
+	event := &AuditEvent{
+		Time:     time.Now().UTC(),
+		Peer:     peerAddress(ctx),
+		Method:   method,
+		LaptopID: laptopID,
+		Outcome:  auditOutcomeOK,
+		Code:     code.String(),
+	}
+	if err != nil {
+		event.Outcome = auditOutcomeFailed
+	}
+	if user != nil {
+		event.Username, event.Role, event.TenantID = user.Username, user.Role, user.TenantID
+	}
+
+	switch {
+	case method == loginMethod:
+		login, _ := req.(*pb.LoginRequest)
+		username := login.GetUsername()
+		switch {
+		case err != nil:
+			event.Type = AuditLoginFailure
+		case user != nil && user.Username == username:
+			event.Type = AuditTokenRefresh
+		default:
+			event.Type = AuditLoginSuccess
 		}
+		if user == nil || user.Username != username {
+			event.Username, event.Role, event.TenantID = username, "", ""
+			// The role and tenant of a new session are read back from the issued token
+			session, _ := res.(*pb.LoginResponse)
+			if loggedIn, err := interceptor.jwtManager.Verify(session.GetAccessToken()); err == nil {
+				event.Role, event.TenantID = loggedIn.Role, loggedIn.TenantID
+			}
+		}
+	case code == codes.PermissionDenied || code == codes.Unauthenticated:
+		event.Type = AuditAccessDenied
+	case isMutatingMethod(method):
+		event.Type = AuditRPCMutation
+	default:
+		return
 	}
 
-	return status.Error(codes.PermissionDenied, "no permission to access this RPC")
+	err = interceptor.auditLog.Record(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "Cannot record the audit event", "method", method, "error", err)
+	}
+}
+
+type userContextKey struct{}
+
+// ContextWithUser returns a copy of the context that carries the authenticated user
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	if user == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the authenticated user of the request, if any
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*User)
+	return user, ok
+}
+
+// authenticatedStream overrides the context of a server stream with one that carries the authenticated user.
+// It also keeps the first laptop ID received on the stream for the audit log.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	laptopID string
+}
+
+func (stream *authenticatedStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *authenticatedStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err == nil && stream.laptopID == "" {
+		stream.laptopID = laptopIDOf(m)
+	}
+	return err
 }
@@ -2,33 +2,89 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
 
 	"github.com/eshaanagg/pcbook/go/pb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type AuthServer struct {
 	pb.UnimplementedAuthServiceServer
 
-	userStore  UserStore
-	jwtManager *JWTManager
+	userStore   UserStore
+	tenantStore TenantStore
+	apiKeyStore APIKeyStore
+	// loginLimiter is nil if failed logins are not throttled
+	loginLimiter *LoginLimiter
+	jwtManager   *JWTManager
+	// auditLog is nil if auditing is disabled
+	auditLog AuditLog
+	// policy defines the roles that can be given to API keys, any role is accepted if nil
+	policy PolicyProvider
 }
 
-func NewAuthServer(userStore UserStore, jwtManager *JWTManager) pb.AuthServiceServer {
-	return &AuthServer{userStore: userStore, jwtManager: jwtManager}
+func NewAuthServer(
+	userStore UserStore,
+	tenantStore TenantStore,
+	apiKeyStore APIKeyStore,
+	loginLimiter *LoginLimiter,
+	jwtManager *JWTManager,
+	auditLog AuditLog,
+	policy PolicyProvider,
+) pb.AuthServiceServer {
+	return &AuthServer{
+		userStore:    userStore,
+		tenantStore:  tenantStore,
+		apiKeyStore:  apiKeyStore,
+		loginLimiter: loginLimiter,
+		jwtManager:   jwtManager,
+		auditLog:     auditLog,
+		policy:       policy,
+	}
 }
 
 func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	user, err := server.userStore.Find(req.GetUsername())
+	username := req.GetUsername()
+	peer := peerAddress(ctx)
+
+	if server.loginLimiter != nil {
+		wait, err := server.loginLimiter.Reserve(username, peer)
+		if err != nil {
+			return nil, statusErrorf(err, "cannot check login attempts")
+		}
+		if wait > 0 {
+			slog.WarnContext(ctx, "Throttled login attempt", "username", username, "peer", peer)
+			return nil, retryError(ctx, wait, nil, fmt.Sprintf("too many failed login attempts, retry in %v", wait.Round(time.Second)))
+		}
+	}
+
+	user, err := server.userStore.Find(username)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+		return nil, statusErrorf(err, "cannot find user")
 	}
 
+	// The attempt was counted as a failure by Reserve
 	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
 		return nil, status.Errorf(codes.NotFound, "incorrect username or password for the user")
 	}
 
+	if server.loginLimiter != nil {
+		err = server.loginLimiter.RecordSuccess(username, peer)
+		if err != nil {
+			slog.ErrorContext(ctx, "Cannot clear the failed logins", "username", username, "error", err)
+		}
+	}
+
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "the user is disabled")
+	}
+
 	token, err := server.jwtManager.Generate(user)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot generate access token")
@@ -37,3 +93,306 @@ func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.
 	res := &pb.LoginResponse{AccessToken: token}
 	return res, nil
 }
+
+// GetJWKS returns the public keys that downstream services can use to verify access tokens
+func (server *AuthServer) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	res := &pb.GetJWKSResponse{}
+	for _, key := range server.jwtManager.JWKS() {
+		res.Keys = append(res.Keys, &pb.JSONWebKey{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+		})
+	}
+
+	return res, nil
+}
+
+// CreateAPIKey creates a new API key. The secret of the key is only returned in this response.
+func (server *AuthServer) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	if req.GetName() == "" || req.GetRole() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "the name and role of the API key are required")
+	}
+	for _, pattern := range req.GetMethods() {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid method pattern %q: %v", pattern, err)
+		}
+	}
+
+	ttl := req.GetTtl().AsDuration()
+	if ttl < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "the ttl of the API key cannot be negative")
+	}
+	if err := server.checkRole(req.GetRole()); err != nil {
+		return nil, err
+	}
+	if server.hasSuperAdminRole(req.GetRole()) && !server.isSuperAdmin(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "only super-admins can create super-admin API keys")
+	}
+
+	createdBy := ""
+	if user, ok := UserFromContext(ctx); ok {
+		createdBy = user.Username
+	}
+
+	// API keys belong to the tenant of the admin that created them
+	key, secret, err := NewAPIKey(req.GetName(), req.GetRole(), tenantFromContext(ctx), req.GetMethods(), ttl, createdBy)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot generate API key")
+	}
+
+	err = server.apiKeyStore.Save(key)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot save API key")
+	}
+
+	slog.InfoContext(ctx, "Created API key", "api_key_id", key.ID, "name", key.Name, "role", key.Role)
+	return &pb.CreateAPIKeyResponse{Key: apiKeyToProto(key), Secret: secret}, nil
+}
+
+func (server *AuthServer) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	keys, err := server.apiKeyStore.List()
+	if err != nil {
+		return nil, statusErrorf(err, "cannot list API keys")
+	}
+
+	res := &pb.ListAPIKeysResponse{}
+	for _, key := range keys {
+		if server.canManageTenant(ctx, key.TenantID) {
+			res.Keys = append(res.Keys, apiKeyToProto(key))
+		}
+	}
+
+	return res, nil
+}
+
+func (server *AuthServer) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	key, err := server.apiKeyStore.Find(req.GetId())
+	if err != nil {
+		return nil, statusErrorf(err, "cannot find API key")
+	}
+	if key == nil || !server.canManageTenant(ctx, key.TenantID) {
+		return nil, status.Errorf(codes.NotFound, "there is no API key with id: %s", req.GetId())
+	}
+
+	err = server.apiKeyStore.Revoke(req.GetId(), time.Now())
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "there is no API key with id: %s", req.GetId())
+	}
+	if err != nil {
+		return nil, statusErrorf(err, "cannot revoke API key")
+	}
+
+	slog.InfoContext(ctx, "Revoked API key", "api_key_id", req.GetId())
+	return &pb.RevokeAPIKeyResponse{}, nil
+}
+
+func apiKeyToProto(key *APIKey) *pb.APIKey {
+	return &pb.APIKey{
+		Id:         key.ID,
+		Name:       key.Name,
+		Role:       key.Role,
+		TenantId:   key.TenantID,
+		Methods:    key.Methods,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  toTimestamp(key.CreatedAt),
+		ExpiresAt:  toTimestamp(key.ExpiresAt),
+		LastUsedAt: toTimestamp(key.LastUsedAt),
+		RevokedAt:  toTimestamp(key.RevokedAt),
+	}
+}
+
+// toTimestamp converts a time to a protobuf timestamp, leaving it unset for the zero time
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+// UnlockUser clears the failed login attempts of a locked account
+func (server *AuthServer) UnlockUser(ctx context.Context, req *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	if server.loginLimiter == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "login throttling is disabled")
+	}
+
+	user, err := server.userStore.Find(req.GetUsername())
+	if err != nil {
+		return nil, statusErrorf(err, "cannot find user")
+	}
+	if user == nil || !server.canManageTenant(ctx, user.TenantID) {
+		return nil, status.Errorf(codes.NotFound, "there is no user with username: %s", req.GetUsername())
+	}
+
+	err = server.loginLimiter.Unlock(req.GetUsername())
+	if err != nil {
+		return nil, statusErrorf(err, "cannot unlock user")
+	}
+
+	slog.InfoContext(ctx, "Unlocked user", "username", req.GetUsername())
+	return &pb.UnlockUserResponse{}, nil
+}
+
+// CreateTenant creates a new tenant, which starts without any user
+func (server *AuthServer) CreateTenant(ctx context.Context, req *pb.CreateTenantRequest) (*pb.CreateTenantResponse, error) {
+	if err := ValidateTenantID(req.GetId()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	tenant, err := CreateTenant(server.tenantStore, req.GetId(), req.GetName())
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "tenant %s already exists", req.GetId())
+	}
+	if err != nil {
+		return nil, statusErrorf(err, "cannot save tenant")
+	}
+
+	slog.InfoContext(ctx, "Created tenant", "tenant_id", tenant.ID)
+	return &pb.CreateTenantResponse{Tenant: tenantToProto(tenant)}, nil
+}
+
+func (server *AuthServer) ListTenants(ctx context.Context, req *pb.ListTenantsRequest) (*pb.ListTenantsResponse, error) {
+	tenants, err := server.tenantStore.List()
+	if err != nil {
+		return nil, statusErrorf(err, "cannot list tenants")
+	}
+
+	res := &pb.ListTenantsResponse{}
+	for _, tenant := range tenants {
+		res.Tenants = append(res.Tenants, tenantToProto(tenant))
+	}
+
+	return res, nil
+}
+
+// CreateUser creates a user in the tenant of the caller. Super-admins can create users in any tenant.
+func (server *AuthServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if req.GetUsername() == "" || req.GetPassword() == "" || req.GetRole() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "the username, password and role of the user are required")
+	}
+	if err := server.checkRole(req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	tenantID := req.GetTenantId()
+	if tenantID == "" {
+		tenantID = tenantFromContext(ctx)
+	}
+	if !server.canManageTenant(ctx, tenantID) {
+		return nil, status.Errorf(codes.PermissionDenied, "cannot create users in the tenant %s", tenantID)
+	}
+	if server.hasSuperAdminRole(req.GetRole()) && !server.isSuperAdmin(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "only super-admins can create super-admins")
+	}
+
+	tenant, err := server.tenantStore.Find(tenantID)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot find tenant")
+	}
+	if tenant == nil {
+		return nil, status.Errorf(codes.NotFound, "there is no tenant with id: %s", tenantID)
+	}
+
+	err = CreateUser(server.userStore, req.GetUsername(), req.GetPassword(), req.GetRole(), tenantID)
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "user %s already exists", req.GetUsername())
+	}
+	if err != nil {
+		return nil, statusErrorf(err, "cannot create user")
+	}
+
+	slog.InfoContext(ctx, "Created user", "username", req.GetUsername(), "role", req.GetRole(), "tenant_id", tenantID)
+	return &pb.CreateUserResponse{Username: req.GetUsername(), TenantId: tenantID}, nil
+}
+
+// QueryAuditLog returns the matching audit events, most recent first.
+// Admins only see the events of their tenant, while super-admins see every event,
+// including failed logins, which have no tenant.
+func (server *AuthServer) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	if server.auditLog == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the audit log is disabled")
+	}
+
+	filter := AuditFilter{
+		Username: req.GetUsername(),
+		Method:   req.GetMethod(),
+	}
+	if req.GetSince() != nil {
+		filter.Since = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		filter.Until = req.GetUntil().AsTime()
+	}
+
+	events, err := server.auditLog.Query(filter)
+	if err != nil {
+		return nil, statusErrorf(err, "cannot query the audit log")
+	}
+
+	res := &pb.QueryAuditLogResponse{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if req.GetLimit() > 0 && len(res.Events) == int(req.GetLimit()) {
+			break
+		}
+		if server.canManageTenant(ctx, events[i].TenantID) {
+			res.Events = append(res.Events, auditEventToProto(events[i]))
+		}
+	}
+
+	return res, nil
+}
+
+func auditEventToProto(event *AuditEvent) *pb.AuditEvent {
+	return &pb.AuditEvent{
+		Time:     toTimestamp(event.Time),
+		Type:     event.Type,
+		Username: event.Username,
+		Role:     event.Role,
+		TenantId: event.TenantID,
+		Peer:     event.Peer,
+		Method:   event.Method,
+		LaptopId: event.LaptopID,
+		Outcome:  event.Outcome,
+		Code:     event.Code,
+	}
+}
+
+func tenantToProto(tenant *Tenant) *pb.Tenant {
+	return &pb.Tenant{
+		Id:        tenant.ID,
+		Name:      tenant.Name,
+		CreatedAt: toTimestamp(tenant.CreatedAt),
+	}
+}
+
+// checkRole returns an InvalidArgument error if the role is not defined by the policy, if any
+func (server *AuthServer) checkRole(role string) error {
+	if server.policy != nil && !server.policy.Policy().DefinesRole(role) {
+		return status.Errorf(codes.InvalidArgument, "the role %q is not defined by the policy", role)
+	}
+	return nil
+}
+
+func (server *AuthServer) isSuperAdmin(ctx context.Context) bool {
+	user, ok := UserFromContext(ctx)
+	return ok && server.hasSuperAdminRole(user.Role)
+}
+
+// hasSuperAdminRole reports whether the role has the super-admin rights, itself or through the roles it inherits
+func (server *AuthServer) hasSuperAdminRole(role string) bool {
+	if server.policy == nil {
+		return role == RoleSuperAdmin
+	}
+	return server.policy.Policy().HasRole(role, RoleSuperAdmin)
+}
+
+// canManageTenant reports whether the caller can manage the users and API keys of a tenant
+func (server *AuthServer) canManageTenant(ctx context.Context, tenantID string) bool {
+	return server.isSuperAdmin(ctx) || tenantFromContext(ctx) == tenantID
+}
@@ -0,0 +1,60 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthServerSuperAdminInheritance(t *testing.T) {
+	t.Parallel()
+
+	// The super-admin rights are also granted to the roles inheriting from superadmin
+	policy, err := service.ParsePolicy([]byte(`
+roles:
+  admin: {}
+  superadmin:
+    inherits: [admin]
+  owner:
+    inherits: [superadmin]
+`), "yaml")
+	require.NoError(t, err)
+	tenantStore := service.NewInMemoryTenantStore()
+	_, err = service.CreateTenant(tenantStore, service.DefaultTenantID, "Default")
+	require.NoError(t, err)
+	_, err = service.CreateTenant(tenantStore, "acme", "Acme")
+	require.NoError(t, err)
+	authServer := service.NewAuthServer(
+		service.NewInMemoryUserStore(),
+		tenantStore,
+		service.NewInMemoryAPIKeyStore(),
+		nil,
+		service.NewJWTManager("secret", time.Minute),
+		nil,
+		policy,
+	)
+
+	owner := service.ContextWithUser(context.Background(), &service.User{Username: "owner1", Role: "owner", TenantID: service.DefaultTenantID})
+	admin := service.ContextWithUser(context.Background(), &service.User{Username: "admin1", Role: service.RoleAdmin, TenantID: service.DefaultTenantID})
+
+	_, err = authServer.CreateUser(owner, &pb.CreateUserRequest{Username: "acme-admin", Password: "secret", Role: service.RoleAdmin, TenantId: "acme"})
+	require.NoError(t, err)
+	_, err = authServer.CreateAPIKey(owner, &pb.CreateAPIKeyRequest{Name: "root", Role: service.RoleSuperAdmin})
+	require.NoError(t, err)
+
+	// The roles the policy does not define are rejected
+	_, err = authServer.CreateUser(owner, &pb.CreateUserRequest{Username: "typo", Password: "secret", Role: "admn"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Granting a role that inherits from superadmin also requires the super-admin rights
+	_, err = authServer.CreateUser(admin, &pb.CreateUserRequest{Username: "owner2", Password: "secret", Role: "owner"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = authServer.CreateUser(admin, &pb.CreateUserRequest{Username: "acme-admin2", Password: "secret", Role: service.RoleAdmin, TenantId: "acme"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// CertificateMapper derives the user of a request from its verified client certificate.
+// The username is the common name of the subject, or the first URI, DNS or email SAN if it has none.
+// The role is looked up by username, and otherwise taken from the first organizational unit of the subject.
+// The tenant is the first organization of the subject, or the default tenant if it has none.
+type CertificateMapper struct {
+	roles map[string]string
+	// tenantStore is nil if the tenants of the certificates are not checked to exist
+	tenantStore TenantStore
+}
+
+// NewCertificateMapper returns a mapper with explicit roles for some identities, which can be nil
+func NewCertificateMapper(roles map[string]string, tenantStore TenantStore) *CertificateMapper {
+	return &CertificateMapper{roles, tenantStore}
+}
+
+// UserFromCertificate returns the user identified by a certificate
+func (mapper *CertificateMapper) UserFromCertificate(certificate *x509.Certificate) (*User, error) {
+	username := certificate.Subject.CommonName
+	if username == "" {
+		switch {
+		case len(certificate.URIs) > 0:
+			username = certificate.URIs[0].String()
+		case len(certificate.DNSNames) > 0:
+			username = certificate.DNSNames[0]
+		case len(certificate.EmailAddresses) > 0:
+			username = certificate.EmailAddresses[0]
+		default:
+			return nil, errors.New("the client certificate has no subject common name or SAN")
+		}
+	}
+
+	role, ok := mapper.roles[username]
+	if !ok && len(certificate.Subject.OrganizationalUnit) > 0 {
+		role = certificate.Subject.OrganizationalUnit[0]
+	}
+	if role == "" {
+		return nil, fmt.Errorf("no role is mapped to the client certificate of %s", username)
+	}
+
+	tenantID := DefaultTenantID
+	if len(certificate.Subject.Organization) > 0 {
+		tenantID = certificate.Subject.Organization[0]
+	}
+	err := ValidateTenantID(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if mapper.tenantStore != nil {
+		tenant, err := mapper.tenantStore.Find(tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find tenant: %w", err)
+		}
+		if tenant == nil {
+			return nil, fmt.Errorf("there is no tenant with id: %s", tenantID)
+		}
+	}
+
+	return &User{Username: username, Role: role, TenantID: tenantID}, nil
+}
+
+// verifiedClientCertificate returns the client certificate of the request if it was verified during the TLS handshake
+func verifiedClientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0]
+}
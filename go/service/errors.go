@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes maps the sentinel errors of the stores, and of the contexts, to the gRPC codes returned to clients
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{ErrAlreadyExists, codes.AlreadyExists},
+	{ErrNotFound, codes.NotFound},
+	{ErrClosed, codes.Unavailable},
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+
+// ErrorCode returns the gRPC code of an error: its own code if it has a status, the code of the sentinel error
+// it wraps, or else Internal
+func ErrorCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.err) {
+			return mapping.code
+		}
+	}
+
+	return codes.Internal
+}
+
+// statusErrorf returns a status error describing the failed operation, with the code of the error that caused it
+func statusErrorf(err error, format string, args ...interface{}) error {
+	return status.Errorf(ErrorCode(err), "%s: %v", fmt.Sprintf(format, args...), err)
+}
+
+// normalizeError gives a status to the errors returned without one
+func normalizeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(ErrorCode(err), err.Error())
+}
+
+// ErrorInterceptor turns the panics of the handlers into Internal errors, and the errors returned
+// without a status into status errors with the code of their sentinel error.
+// It is the last interceptor of the chain, so that the others see the normalized errors. The panics
+// of the other interceptors are left to the RecoveryInterceptor.
+type ErrorInterceptor struct{}
+
+func NewErrorInterceptor() *ErrorInterceptor {
+	return &ErrorInterceptor{}
+}
+
+// Unary returns a server interceptor function to recover and normalize the errors of unary RPC
+func (interceptor *ErrorInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (res interface{}, err error) {
+		defer recoverPanic(ctx, info.FullMethod, &err)
+
+		res, err = handler(ctx, req)
+		return res, normalizeError(err)
+	}
+}
+
+// Stream returns a server interceptor function to recover and normalize the errors of stream RPC
+func (interceptor *ErrorInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer recoverPanic(stream.Context(), info.FullMethod, &err)
+
+		return normalizeError(handler(srv, stream))
+	}
+}
+
+// RecoveryInterceptor turns the panics of the interceptors that come after it, and of the handlers, into Internal errors.
+// It comes right after the RequestIDInterceptor, at the start of the chain, so that a panic in any other interceptor
+// does not crash the server and is logged with the request ID,
+// while the ErrorInterceptor, the last one, recovers the panics of the handlers for the others to see their status.
+type RecoveryInterceptor struct{}
+
+func NewRecoveryInterceptor() *RecoveryInterceptor {
+	return &RecoveryInterceptor{}
+}
+
+// Unary returns a server interceptor function to recover the panics of unary RPC
+func (interceptor *RecoveryInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (res interface{}, err error) {
+		defer recoverPanic(ctx, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a server interceptor function to recover the panics of stream RPC
+func (interceptor *RecoveryInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer recoverPanic(stream.Context(), info.FullMethod, &err)
+
+		return handler(srv, stream)
+	}
+}
+
+// recoverPanic logs the stack trace of a panic, and replaces the result of the call with an Internal error
+func recoverPanic(ctx context.Context, method string, err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	slog.ErrorContext(ctx, "Recovered from a panic", "method", method, "panic", recovered, "stack", string(debug.Stack()))
+	*err = status.Error(codes.Internal, "internal server error")
+}
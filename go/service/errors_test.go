@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, codes.OK, service.ErrorCode(nil))
+	require.Equal(t, codes.AlreadyExists, service.ErrorCode(fmt.Errorf("cannot save: %w", service.ErrAlreadyExists)))
+	require.Equal(t, codes.NotFound, service.ErrorCode(service.ErrNotFound))
+	require.Equal(t, codes.Unavailable, service.ErrorCode(service.ErrClosed))
+	require.Equal(t, codes.DeadlineExceeded, service.ErrorCode(context.DeadlineExceeded))
+	require.Equal(t, codes.PermissionDenied, service.ErrorCode(status.Error(codes.PermissionDenied, "denied")))
+	require.Equal(t, codes.Internal, service.ErrorCode(errors.New("disk full")))
+}
+
+func TestErrorInterceptor(t *testing.T) {
+	t.Parallel()
+
+	unary := service.NewErrorInterceptor().Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/eshaanagg.pcbook.LaptopService/CreateLaptop"}
+	call := func(handler grpc.UnaryHandler) error {
+		_, err := unary(context.Background(), nil, info, handler)
+		return err
+	}
+
+	err := call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("nil map")
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.NotContains(t, err.Error(), "nil map")
+
+	err = call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("cannot save laptop: %w", service.ErrAlreadyExists)
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	err = call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "invalid laptop")
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream := service.NewErrorInterceptor().Stream()
+	err = stream(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/eshaanagg.pcbook.LaptopService/RateLaptop"}, func(srv interface{}, stream grpc.ServerStream) error {
+		var ratings map[string]int
+		ratings["laptop"]++
+		return nil
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	// The handler of the recovery interceptor is the rest of the chain, such as an interceptor that panics
+	unary := service.NewRecoveryInterceptor().Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/eshaanagg.pcbook.LaptopService/CreateLaptop"}
+	_, err := unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("nil user")
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.NotContains(t, err.Error(), "nil user")
+
+	stream := service.NewRecoveryInterceptor().Stream()
+	err = stream(nil, &contextStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/eshaanagg.pcbook.LaptopService/SearchLaptop"}, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("nil filter")
+	})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
+
+// contextStream is a server stream that only has a context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *contextStream) Context() context.Context {
+	return stream.ctx
+}
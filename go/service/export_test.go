@@ -0,0 +1,8 @@
+package service
+
+import "time"
+
+// SetClock replaces the clock of the limiter, so that the tests do not depend on the wall time
+func (limiter *LoginLimiter) SetClock(now func() time.Time) {
+	limiter.now = now
+}
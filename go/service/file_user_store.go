@@ -0,0 +1,216 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const userFileName = "users.json"
+
+// FileUserStore stores users in a JSON file inside a data directory.
+// Every change rewrites a temporary file and renames it over the previous one,
+// so a crash never leaves a partially written file behind.
+type FileUserStore struct {
+	mutex    sync.RWMutex
+	filename string
+	users    map[string]*User
+	closed   bool
+}
+
+// storedUser is the representation of a user in the file
+type storedUser struct {
+	Username       string    `json:"username"`
+	HashedPassword string    `json:"hashed_password"`
+	Role           string    `json:"role"`
+	TenantID       string    `json:"tenant_id"`
+	Disabled       bool      `json:"disabled,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// NewFileUserStore opens the user store in a data directory, creating the directory if needed
+func NewFileUserStore(dataDir string) (*FileUserStore, error) {
+	err := os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create data directory: %w", err)
+	}
+
+	store := &FileUserStore{
+		filename: filepath.Join(dataDir, userFileName),
+		users:    make(map[string]*User),
+	}
+
+	data, err := os.ReadFile(store.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read user file: %w", err)
+	}
+
+	var stored []storedUser
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse user file %s: %w", store.filename, err)
+	}
+
+	for _, record := range stored {
+		store.users[record.Username] = &User{
+			Username:       record.Username,
+			HashedPassword: record.HashedPassword,
+			Role:           record.Role,
+			TenantID:       record.TenantID,
+			Disabled:       record.Disabled,
+			CreatedAt:      record.CreatedAt,
+			UpdatedAt:      record.UpdatedAt,
+		}
+	}
+
+	return store, nil
+}
+
+func (store *FileUserStore) Save(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.closed {
+		return ErrClosed
+	}
+	if store.users[user.Username] != nil {
+		return ErrAlreadyExists
+	}
+
+	return store.write(user)
+}
+
+func (store *FileUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.closed {
+		return ErrClosed
+	}
+	if store.users[user.Username] == nil {
+		return ErrNotFound
+	}
+
+	updated := user.Clone()
+	updated.UpdatedAt = time.Now()
+	return store.write(updated)
+}
+
+func (store *FileUserStore) Find(username string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user := store.users[username]
+	if user == nil {
+		return nil, nil
+	}
+
+	return user.Clone(), nil
+}
+
+// Close waits for the write in progress, if any, and rejects later changes.
+// Every change is already on disk once Save or Update returns, so there is nothing to flush.
+func (store *FileUserStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.closed = true
+	return nil
+}
+
+// HealthCheck verifies that the users were loaded and that changes can still be written to the data directory
+func (store *FileUserStore) HealthCheck() error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if store.closed {
+		return ErrClosed
+	}
+
+	return checkWritable(filepath.Dir(store.filename))
+}
+
+// write persists the users with a changed user, and only applies the change in memory
+// once it is on disk. The caller must hold the mutex.
+func (store *FileUserStore) write(changed *User) error {
+	stored := make([]storedUser, 0, len(store.users)+1)
+	for username, user := range store.users {
+		if username != changed.Username {
+			stored = append(stored, toStoredUser(user))
+		}
+	}
+	stored = append(stored, toStoredUser(changed))
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Username < stored[j].Username })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode users: %w", err)
+	}
+
+	err = writeFileAtomic(store.filename, data)
+	if err != nil {
+		return err
+	}
+
+	store.users[changed.Username] = changed.Clone()
+	return nil
+}
+
+func toStoredUser(user *User) storedUser {
+	return storedUser{
+		Username:       user.Username,
+		HashedPassword: user.HashedPassword,
+		Role:           user.Role,
+		TenantID:       user.TenantID,
+		Disabled:       user.Disabled,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
+	}
+}
+
+// writeFileAtomic replaces a file with new content by writing a temporary file in the
+// same directory, syncing it to disk and renaming it over the destination
+func writeFileAtomic(filename string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	tempName := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempName, filename)
+	}
+	if err != nil {
+		os.Remove(tempName)
+		return fmt.Errorf("cannot write %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// checkWritable verifies that files can be created in a directory
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+
+	file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,94 @@
+package service_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileUserStorePersistence(t *testing.T) {
+	t.Parallel()
+
+	dataDir := t.TempDir()
+	store, err := service.NewFileUserStore(dataDir)
+	require.NoError(t, err)
+
+	err = service.CreateUser(store, "user1", "secret", "user", service.DefaultTenantID)
+	require.NoError(t, err)
+	err = service.CreateUser(store, "user1", "other", "user", service.DefaultTenantID)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+
+	user, err := store.Find("user1")
+	require.NoError(t, err)
+	user.Disabled = true
+	require.NoError(t, store.Update(user))
+
+	// A new store over the same directory sees the same users
+	reopened, err := service.NewFileUserStore(dataDir)
+	require.NoError(t, err)
+	found, err := reopened.Find("user1")
+	require.NoError(t, err)
+	require.True(t, found.IsCorrectPassword("secret"))
+	require.True(t, found.Disabled)
+	require.Equal(t, user.CreatedAt.Unix(), found.CreatedAt.Unix())
+	require.True(t, found.UpdatedAt.After(user.UpdatedAt))
+
+	err = reopened.Update(&service.User{Username: "unknown"})
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	// No temporary files are left behind by the atomic writes
+	entries, err := os.ReadDir(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// A closed store rejects changes but can still be read
+	require.NoError(t, reopened.Close())
+	err = service.CreateUser(reopened, "user2", "secret", "user", service.DefaultTenantID)
+	require.ErrorIs(t, err, service.ErrClosed)
+	found, err = reopened.Find("user1")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+}
+
+func TestInMemoryUserStoreUpdate(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryUserStore()
+	err := service.CreateUser(store, "user1", "secret", "user", service.DefaultTenantID)
+	require.NoError(t, err)
+
+	user, err := store.Find("user1")
+	require.NoError(t, err)
+	user.Disabled = true
+	require.NoError(t, store.Update(user))
+
+	found, err := store.Find("user1")
+	require.NoError(t, err)
+	require.True(t, found.Disabled)
+	require.Equal(t, user.CreatedAt, found.CreatedAt)
+	require.True(t, found.UpdatedAt.After(user.UpdatedAt))
+
+	err = store.Update(&service.User{Username: "unknown"})
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryUserStore()
+	password, err := service.BootstrapAdmin(store, "admin", "")
+	require.NoError(t, err)
+	require.NotEmpty(t, password)
+
+	admin, err := store.Find("admin")
+	require.NoError(t, err)
+	require.Equal(t, service.RoleSuperAdmin, admin.Role)
+	require.True(t, admin.IsCorrectPassword(password))
+
+	// The admin is only created once
+	password, err = service.BootstrapAdmin(store, "admin", "other")
+	require.NoError(t, err)
+	require.Empty(t, password)
+}
@@ -0,0 +1,512 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/serializer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// GatewayPrefix is the path prefix of the routes of the HTTP gateway
+const GatewayPrefix = "/v1/"
+
+const (
+	// maxGatewayBodySize is the size limit of the JSON request bodies, in bytes
+	maxGatewayBodySize = 1 << 20
+	// gatewayChunkSize is the size of the chunks an uploaded image is streamed in
+	gatewayChunkSize = 32 << 10
+	// gatewayImageField is the multipart form field of an uploaded image
+	gatewayImageField = "image"
+)
+
+// gatewayHeaders are the response metadata forwarded to the HTTP clients as headers
+var gatewayHeaders = []string{"retry-after", RequestIDKey}
+
+// httpStatusCodes maps the gRPC status codes to the HTTP status of the gateway responses
+var httpStatusCodes = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatusFromCode returns the HTTP status of a gRPC status code
+func HTTPStatusFromCode(code codes.Code) int {
+	if httpStatus, ok := httpStatusCodes[code]; ok {
+		return httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// Gateway is an HTTP handler serving the LaptopService and the AuthService as JSON resources.
+// It calls the gRPC server through a client connection, so that the requests go through every interceptor:
+//   - POST /v1/login
+//   - POST /v1/laptops
+//   - GET /v1/laptops?max_price_usd=...&min_ram.unit=GIGABYTE, streaming the laptops as NDJSON
+//   - POST /v1/laptops/{id}/images, with the image in the multipart `image` field
+//   - POST /v1/laptops/{id}/ratings
+type Gateway struct {
+	laptopClient pb.LaptopServiceClient
+	authClient   pb.AuthServiceClient
+}
+
+func NewGateway(conn grpc.ClientConnInterface) *Gateway {
+	return &Gateway{
+		laptopClient: pb.NewLaptopServiceClient(conn),
+		authClient:   pb.NewAuthServiceClient(conn),
+	}
+}
+
+func (gateway *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == GatewayPrefix+"login":
+		if allowMethods(w, r, http.MethodPost) {
+			gateway.login(w, r)
+		}
+	case path == GatewayPrefix+"laptops":
+		if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			gateway.searchLaptop(w, r)
+		} else {
+			gateway.createLaptop(w, r)
+		}
+	default:
+		laptopId, resource, ok := strings.Cut(strings.TrimPrefix(path, GatewayPrefix+"laptops/"), "/")
+		if !strings.HasPrefix(path, GatewayPrefix+"laptops/") || !ok || laptopId == "" {
+			writeGatewayError(w, r, status.Errorf(codes.NotFound, "no route for %s", path))
+			return
+		}
+
+		switch resource {
+		case "images":
+			if allowMethods(w, r, http.MethodPost) {
+				gateway.uploadImage(w, r, laptopId)
+			}
+		case "ratings":
+			if allowMethods(w, r, http.MethodPost) {
+				gateway.rateLaptop(w, r, laptopId)
+			}
+		default:
+			writeGatewayError(w, r, status.Errorf(codes.NotFound, "no route for %s", path))
+		}
+	}
+}
+
+func (gateway *Gateway) login(w http.ResponseWriter, r *http.Request) {
+	req := &pb.LoginRequest{}
+	if err := readGatewayRequest(r, req); err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	var header, trailer metadata.MD
+	res, err := gateway.authClient.Login(outgoingGatewayContext(r), req, grpc.Header(&header), grpc.Trailer(&trailer))
+	forwardGatewayHeaders(w, header, trailer)
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+	writeGatewayResponse(w, r, http.StatusOK, res)
+}
+
+func (gateway *Gateway) createLaptop(w http.ResponseWriter, r *http.Request) {
+	laptop := &pb.Laptop{}
+	if err := readGatewayRequest(r, laptop); err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	var header, trailer metadata.MD
+	res, err := gateway.laptopClient.CreateLaptop(
+		outgoingGatewayContext(r),
+		&pb.CreateLaptopRequest{Laptop: laptop},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+	forwardGatewayHeaders(w, header, trailer)
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", GatewayPrefix+"laptops/"+res.GetId())
+	writeGatewayResponse(w, r, http.StatusCreated, res)
+}
+
+// searchLaptop streams the laptops as newline delimited JSON. An error occurring after the first laptop
+// is sent is reported by a last line with an `error` object, as the HTTP status is already sent.
+func (gateway *Gateway) searchLaptop(w http.ResponseWriter, r *http.Request) {
+	filter := &pb.Filter{}
+	if err := setQueryFields(filter.ProtoReflect(), r.URL.Query()); err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(outgoingGatewayContext(r))
+	defer cancel()
+	stream, err := gateway.laptopClient.SearchLaptop(ctx, &pb.SearchLaptopRequest{Filter: filter})
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	started := false
+	for {
+		res, err := stream.Recv()
+		if err != nil && !started {
+			forwardStreamHeaders(w, stream)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !started {
+				writeGatewayError(w, r, err)
+				return
+			}
+			writeGatewayStreamError(w, r, err)
+			return
+		}
+
+		if !started {
+			started = true
+			header, _ := stream.Header()
+			forwardGatewayHeaders(w, header)
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		data, err := serializer.JSONOptions.Marshal(res.GetLaptop())
+		if err != nil {
+			writeGatewayStreamError(w, r, status.Errorf(codes.Internal, "cannot marshal laptop: %v", err))
+			return
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			slog.InfoContext(r.Context(), "The HTTP client stopped reading the search results", "error", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (gateway *Gateway) uploadImage(w http.ResponseWriter, r *http.Request, laptopId string) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeGatewayError(w, r, status.Errorf(codes.InvalidArgument, "expected a multipart form: %v", err))
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			writeGatewayError(w, r, status.Errorf(codes.InvalidArgument, "the %q form field is required", gatewayImageField))
+			return
+		}
+		if err != nil {
+			writeGatewayError(w, r, status.Errorf(codes.InvalidArgument, "cannot read the multipart form: %v", err))
+			return
+		}
+		if part.FormName() == gatewayImageField {
+			gateway.sendImage(w, r, laptopId, part.FileName(), part)
+			return
+		}
+	}
+}
+
+// sendImage streams the image to the UploadImage RPC. The image type is the extension of the file name.
+func (gateway *Gateway) sendImage(w http.ResponseWriter, r *http.Request, laptopId string, filename string, image io.Reader) {
+	imageType := filepath.Ext(filename)
+	if imageType == "" {
+		writeGatewayError(w, r, status.Errorf(codes.InvalidArgument, "the image file name %q has no extension", filename))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(outgoingGatewayContext(r))
+	defer cancel()
+	stream, err := gateway.laptopClient.UploadImage(ctx)
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopId, ImageType: imageType}},
+	})
+	buffer := make([]byte, gatewayChunkSize)
+	for err == nil {
+		n, readErr := image.Read(buffer)
+		if n > 0 {
+			err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: buffer[:n]}})
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil && err == nil {
+			writeGatewayError(w, r, status.Errorf(codes.InvalidArgument, "cannot read the image: %v", readErr))
+			return
+		}
+	}
+
+	// io.EOF means that the server ended the RPC, whose status is returned by CloseAndRecv
+	if err != nil && err != io.EOF {
+		writeGatewayError(w, r, err)
+		return
+	}
+	res, err := stream.CloseAndRecv()
+	forwardStreamHeaders(w, stream)
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+	writeGatewayResponse(w, r, http.StatusCreated, res)
+}
+
+func (gateway *Gateway) rateLaptop(w http.ResponseWriter, r *http.Request, laptopId string) {
+	req := &pb.RateLaptopRequest{}
+	if err := readGatewayRequest(r, req); err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+	req.LaptopId = laptopId
+
+	ctx, cancel := context.WithCancel(outgoingGatewayContext(r))
+	defer cancel()
+	stream, err := gateway.laptopClient.RateLaptop(ctx)
+	if err != nil {
+		writeGatewayError(w, r, err)
+		return
+	}
+
+	// A failed send is reported by Recv, with the status of the RPC
+	if err := stream.Send(req); err == nil {
+		_ = stream.CloseSend()
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		forwardStreamHeaders(w, stream)
+		writeGatewayError(w, r, err)
+		return
+	}
+	header, _ := stream.Header()
+	forwardGatewayHeaders(w, header)
+	writeGatewayResponse(w, r, http.StatusOK, res)
+}
+
+// allowMethods writes a 405 response if the request method is not one of the given ones
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// outgoingGatewayContext forwards the credentials and the request ID of the HTTP request as gRPC metadata.
+// The bearer token of the `Authorization` header is sent as the `authorization` metadata the AuthInterceptor verifies.
+// The address of the HTTP client is forwarded for the server to throttle and audit the client instead of the gateway.
+func outgoingGatewayContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		md.Set(ForwardedForKey, host)
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		md.Set("authorization", token)
+	}
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		md.Set("x-api-key", apiKey)
+	}
+	if requestID := r.Header.Get(RequestIDKey); requestID != "" {
+		md.Set(RequestIDKey, requestID)
+	}
+
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// forwardGatewayHeaders copies the gatewayHeaders of the response metadata to the HTTP response
+func forwardGatewayHeaders(w http.ResponseWriter, mds ...metadata.MD) {
+	for _, md := range mds {
+		for _, key := range gatewayHeaders {
+			if values := md.Get(key); len(values) > 0 {
+				w.Header().Set(key, values[0])
+			}
+		}
+	}
+}
+
+// forwardStreamHeaders copies the gatewayHeaders of the header and the trailer of a stream, which must be ended
+func forwardStreamHeaders(w http.ResponseWriter, stream grpc.ClientStream) {
+	header, _ := stream.Header()
+	forwardGatewayHeaders(w, header, stream.Trailer())
+}
+
+func readGatewayRequest(r *http.Request, message proto.Message) error {
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxGatewayBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return status.Errorf(codes.InvalidArgument, "the request body is larger than %d bytes", maxBytesErr.Limit)
+		}
+		return status.Errorf(codes.InvalidArgument, "cannot read the request body: %v", err)
+	}
+
+	if err := protojson.Unmarshal(data, message); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid JSON request body: %v", err)
+	}
+	return nil
+}
+
+func writeGatewayResponse(w http.ResponseWriter, r *http.Request, httpStatus int, message proto.Message) {
+	data, err := serializer.JSONOptions.Marshal(message)
+	if err != nil {
+		writeGatewayError(w, r, status.Errorf(codes.Internal, "cannot marshal response: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if _, err := w.Write(data); err != nil {
+		slog.InfoContext(r.Context(), "Cannot write the gateway response", "error", err)
+	}
+}
+
+// writeGatewayError writes the status of the error as a google.rpc.Status JSON object, with its details
+func writeGatewayError(w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	data, marshalErr := serializer.JSONOptions.Marshal(st.Proto())
+	if marshalErr != nil {
+		slog.ErrorContext(r.Context(), "Cannot marshal the gateway error", "error", marshalErr)
+		data = []byte(fmt.Sprintf(`{"code":%d,"message":%q}`, st.Code(), st.Message()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatusFromCode(st.Code()))
+	if _, err := w.Write(data); err != nil {
+		slog.InfoContext(r.Context(), "Cannot write the gateway error", "error", err)
+	}
+}
+
+// writeGatewayStreamError ends an NDJSON stream with a line holding the status of the error
+func writeGatewayStreamError(w http.ResponseWriter, r *http.Request, err error) {
+	data, marshalErr := serializer.JSONOptions.Marshal(status.Convert(err).Proto())
+	if marshalErr != nil {
+		slog.ErrorContext(r.Context(), "Cannot marshal the gateway error", "error", marshalErr)
+		return
+	}
+	if _, err := fmt.Fprintf(w, "{\"error\":%s}\n", data); err != nil {
+		slog.InfoContext(r.Context(), "Cannot write the gateway error", "error", err)
+	}
+}
+
+// setQueryFields sets the fields of the message named by the query parameters. Nested fields are named
+// with dots, such as `min_ram.value`, and enum values by their name or number.
+func setQueryFields(message protoreflect.Message, query url.Values) error {
+	for name, values := range query {
+		target := message
+		path := strings.Split(name, ".")
+		for i, fieldName := range path {
+			field := target.Descriptor().Fields().ByName(protoreflect.Name(fieldName))
+			if field == nil || field.IsList() || field.IsMap() {
+				return status.Errorf(codes.InvalidArgument, "unknown query parameter %q", name)
+			}
+
+			if i < len(path)-1 {
+				if field.Kind() != protoreflect.MessageKind {
+					return status.Errorf(codes.InvalidArgument, "unknown query parameter %q", name)
+				}
+				target = target.Mutable(field).Message()
+				continue
+			}
+
+			value, err := parseQueryValue(field, values[len(values)-1])
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid query parameter %q: %v", name, err)
+			}
+			target.Set(field, value)
+		}
+	}
+
+	return nil
+}
+
+func parseQueryValue(field protoreflect.FieldDescriptor, text string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), nil
+	case protoreflect.BoolKind:
+		value, err := strconv.ParseBool(text)
+		return protoreflect.ValueOfBool(value), err
+	case protoreflect.DoubleKind:
+		value, err := strconv.ParseFloat(text, 64)
+		return protoreflect.ValueOfFloat64(value), err
+	case protoreflect.FloatKind:
+		value, err := strconv.ParseFloat(text, 32)
+		return protoreflect.ValueOfFloat32(float32(value)), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		value, err := strconv.ParseInt(text, 10, 32)
+		return protoreflect.ValueOfInt32(int32(value)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		value, err := strconv.ParseInt(text, 10, 64)
+		return protoreflect.ValueOfInt64(value), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		value, err := strconv.ParseUint(text, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(value)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		value, err := strconv.ParseUint(text, 10, 64)
+		return protoreflect.ValueOfUint64(value), err
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByName(protoreflect.Name(text)); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		number, err := strconv.ParseInt(text, 10, 32)
+		if err != nil || field.Enum().Values().ByNumber(protoreflect.EnumNumber(number)) == nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown %s value %q", field.Enum().Name(), text)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(number)), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("%s fields cannot be set from the query", field.Kind())
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ForwardedForKey is the metadata the gateway forwards the address of its HTTP client in.
+// It is only trusted on the connections of the GatewayListener.
+const ForwardedForKey = "x-forwarded-for"
+
+// gatewayAddr is the address of both ends of the in-process connections of the gateway
+type gatewayAddr struct{}
+
+func (gatewayAddr) Network() string { return "gateway" }
+func (gatewayAddr) String() string  { return "gateway" }
+
+// gatewayConn is an in-process connection of the gateway
+type gatewayConn struct {
+	net.Conn
+}
+
+func (conn *gatewayConn) LocalAddr() net.Addr  { return gatewayAddr{} }
+func (conn *gatewayConn) RemoteAddr() net.Addr { return gatewayAddr{} }
+
+// GatewayListener connects the gateway to the gRPC server in process, so that its requests go through every
+// interceptor without a TLS handshake or a client certificate, and so that the server can trust the client
+// address it forwards. The gRPC server must serve it with the transport credentials of GatewayCredentials.
+type GatewayListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewGatewayListener returns a listener the gateway dials with Dial
+func NewGatewayListener() *GatewayListener {
+	return &GatewayListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (listener *GatewayListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *GatewayListener) Close() error {
+	listener.closeOnce.Do(func() { close(listener.closed) })
+	return nil
+}
+
+func (listener *GatewayListener) Addr() net.Addr {
+	return gatewayAddr{}
+}
+
+// Dial opens a connection to the server of the listener, and can be given to grpc.WithContextDialer
+func (listener *GatewayListener) Dial(ctx context.Context, address string) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case listener.conns <- &gatewayConn{server}:
+		return &gatewayConn{client}, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// gatewayAuthInfo marks the in-process connections of the gateway, which are private to the process
+type gatewayAuthInfo struct {
+	credentials.CommonAuthInfo
+}
+
+func (gatewayAuthInfo) AuthType() string {
+	return "gateway"
+}
+
+// gatewayCredentials skip the handshake of the in-process connections of the gateway
+type gatewayCredentials struct {
+	credentials.TransportCredentials
+}
+
+// GatewayCredentials secures the connections of the server with the transport credentials,
+// except the in-process connections of the GatewayListener
+func GatewayCredentials(transportCredentials credentials.TransportCredentials) credentials.TransportCredentials {
+	return &gatewayCredentials{transportCredentials}
+}
+
+func (creds *gatewayCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(*gatewayConn); ok {
+		return conn, gatewayAuthInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity}}, nil
+	}
+	return creds.TransportCredentials.ServerHandshake(conn)
+}
+
+func (creds *gatewayCredentials) Clone() credentials.TransportCredentials {
+	return &gatewayCredentials{creds.TransportCredentials.Clone()}
+}
+
+// forwardedAddress returns the client address forwarded by the gateway, if the request comes from its connection
+func forwardedAddress(ctx context.Context, p *peer.Peer) (string, bool) {
+	if _, ok := p.AuthInfo.(gatewayAuthInfo); !ok {
+		return "", false
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, ForwardedForKey)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
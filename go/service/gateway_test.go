@@ -0,0 +1,233 @@
+package service_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/serializer"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// startTestGateway serves the gateway of a server authenticating its users with the test policy
+func startTestGateway(t *testing.T) string {
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+
+	userStore := service.NewInMemoryUserStore()
+	require.NoError(t, service.CreateUser(userStore, "admin1", "secret", "admin", service.DefaultTenantID))
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	authServer := service.NewAuthServer(userStore, nil, nil, nil, jwtManager, nil, policy)
+	laptopServer := service.NewLaptopServer(
+		service.NewInMemoryLaptopStore(),
+		service.NewDiskImageStore(t.TempDir()),
+		service.NewInMemoryRatingStore(),
+		service.DefaultMaxImageSize,
+		policy,
+	)
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, nil)
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	httpServer := httptest.NewServer(service.NewGateway(conn))
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL
+}
+
+func TestGatewayForwardsClientAddress(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	_, serverCert, serverKey := ca.issue(t, &x509.Certificate{
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCertificate, _, _ := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "vendor1", OrganizationalUnit: []string{"vendor"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	caFile := ca.writePEM(t)
+	serverConfig, err := service.LoadServerTLSConfig(serverCert, serverKey, caFile, service.ClientAuthRequire)
+	require.NoError(t, err)
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+	auditLog, err := service.NewFileAuditLog(t.TempDir(), 1<<20, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, auditLog)
+
+	grpcServer := grpc.NewServer(
+		grpc.Creds(service.GatewayCredentials(credentials.NewTLS(serverConfig))),
+		grpc.UnaryInterceptor(interceptor.Unary()),
+	)
+	pb.RegisterAuthServiceServer(grpcServer, service.NewAuthServer(service.NewInMemoryUserStore(), nil, nil, nil, jwtManager, nil, policy))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gatewayListener := service.NewGatewayListener()
+	go grpcServer.Serve(listener)
+	go grpcServer.Serve(gatewayListener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("passthrough:///gateway", grpc.WithContextDialer(gatewayListener.Dial), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	httpServer := httptest.NewServer(service.NewGateway(conn))
+	t.Cleanup(httpServer.Close)
+
+	// The gateway reaches the server without a client certificate, and the login is attributed to its HTTP client
+	res := callGateway(t, http.MethodPost, httpServer.URL+"/v1/login", "", "application/json", strings.NewReader(`{"username":"admin1","password":"wrong"}`), nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// The forwarded address is ignored on the other connections
+	rootCAs, err := service.LoadCertPool(caFile)
+	require.NoError(t, err)
+	clientConfig := &tls.Config{RootCAs: rootCAs, Certificates: []tls.Certificate{clientCertificate}, MinVersion: tls.VersionTLS12}
+	directConn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+	require.NoError(t, err)
+	defer directConn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), service.ForwardedForKey, "203.0.113.7")
+	_, err = pb.NewAuthServiceClient(directConn).Login(ctx, &pb.LoginRequest{Username: "admin1", Password: "wrong"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	events, err := auditLog.Query(service.AuditFilter{Method: "/eshaanagg.pcbook.AuthService/Login"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "127.0.0.1", events[0].Peer)
+	require.Equal(t, "127.0.0.1", events[1].Peer)
+}
+
+// callGateway sends the request and decodes the JSON response into the message, if any
+func callGateway(t *testing.T, method string, url string, token string, contentType string, body io.Reader, message proto.Message) *http.Response {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	if message != nil {
+		require.NoError(t, protojson.Unmarshal(data, message), string(data))
+	}
+	return res
+}
+
+func TestGateway(t *testing.T) {
+	t.Parallel()
+
+	url := startTestGateway(t)
+	laptop := sample.NewLaptop()
+	laptopJSON, err := serializer.JSONOptions.Marshal(laptop)
+	require.NoError(t, err)
+
+	res := callGateway(t, http.MethodPost, url+"/v1/laptops", "", "application/json", bytes.NewReader(laptopJSON), nil)
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	loginRes := &pb.LoginResponse{}
+	res = callGateway(t, http.MethodPost, url+"/v1/login", "", "application/json", strings.NewReader(`{"username":"admin1","password":"secret"}`), loginRes)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	token := loginRes.GetAccessToken()
+	require.NotEmpty(t, token)
+
+	createRes := &pb.CreateLaptopResponse{}
+	res = callGateway(t, http.MethodPost, url+"/v1/laptops", token, "application/json", bytes.NewReader(laptopJSON), createRes)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.Equal(t, laptop.GetId(), createRes.GetId())
+	require.Equal(t, "/v1/laptops/"+laptop.GetId(), res.Header.Get("Location"))
+
+	// The details of the status are part of the error
+	errorRes := &spb.Status{}
+	res = callGateway(t, http.MethodPost, url+"/v1/laptops", token, "application/json", strings.NewReader(`{"brand":"Apple"}`), errorRes)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	require.Equal(t, int32(codes.InvalidArgument), errorRes.GetCode())
+	require.Len(t, errorRes.GetDetails(), 1)
+
+	// Search results are streamed as one laptop per line
+	req, err := http.NewRequest(http.MethodGet, url+"/v1/laptops?max_price_usd=100000&min_ram.unit=BIT", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	searchRes, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer searchRes.Body.Close()
+	require.Equal(t, http.StatusOK, searchRes.StatusCode)
+	require.Equal(t, "application/x-ndjson", searchRes.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(searchRes.Body)
+	var found []string
+	for scanner.Scan() {
+		found = append(found, scanner.Text())
+	}
+	require.Len(t, found, 1)
+	foundLaptop := &pb.Laptop{}
+	require.NoError(t, protojson.Unmarshal([]byte(found[0]), foundLaptop))
+	require.Equal(t, laptop.GetId(), foundLaptop.GetId())
+
+	res = callGateway(t, http.MethodGet, url+"/v1/laptops?max_price=1", token, "", nil, nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("image", "laptop.jpg")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte{0xff}, 100<<10))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	uploadRes := &pb.UploadImageResponse{}
+	res = callGateway(t, http.MethodPost, url+"/v1/laptops/"+laptop.GetId()+"/images", token, writer.FormDataContentType(), &form, uploadRes)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NotEmpty(t, uploadRes.GetId())
+	require.Equal(t, uint32(100<<10), uploadRes.GetSize())
+
+	rateRes := &pb.RateLaptopResponse{}
+	res = callGateway(t, http.MethodPost, url+"/v1/laptops/"+laptop.GetId()+"/ratings", token, "application/json", strings.NewReader(`{"score":8}`), rateRes)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, uint32(1), rateRes.GetRatedCount())
+	require.Equal(t, 8.0, rateRes.GetAverageScore())
+
+	res = callGateway(t, http.MethodDelete, url+"/v1/laptops", token, "", nil, nil)
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	res = callGateway(t, http.MethodPost, url+"/v1/laptops/"+laptop.GetId()+"/reviews", token, "", nil, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
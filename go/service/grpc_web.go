@@ -0,0 +1,74 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+)
+
+// corsMaxAge is how long browsers may cache the result of a preflight request
+const corsMaxAge = 10 * time.Minute
+
+// gatewayCORSHeaders are the headers browsers may send to, and read from, the REST gateway
+var (
+	gatewayCORSRequestHeaders  = []string{"Authorization", "Content-Type", "X-API-Key", RequestIDKey}
+	gatewayCORSResponseHeaders = []string{"Location", "Retry-After", RequestIDKey}
+	// grpcWebCORSRequestHeaders are the headers of the gRPC-Web protocol and the request metadata of the services
+	grpcWebCORSRequestHeaders = []string{
+		"content-type", "x-grpc-web", "x-user-agent", "grpc-timeout",
+		"authorization", "x-api-key", RequestIDKey,
+	}
+)
+
+// OriginAllowed returns whether the origin is one of the allowed origins, `*` allowing any origin
+func OriginAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCORSHandler lets the browser pages of the allowed origins call the REST gateway with their credentials
+func NewCORSHandler(handler http.Handler, allowedOrigins []string) http.Handler {
+	return cors.New(cors.Options{
+		AllowOriginFunc:  func(origin string) bool { return OriginAllowed(allowedOrigins, origin) },
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   gatewayCORSRequestHeaders,
+		ExposedHeaders:   gatewayCORSResponseHeaders,
+		AllowCredentials: true,
+		MaxAge:           int(corsMaxAge / time.Second),
+	}).Handler(handler)
+}
+
+// NewGRPCWebHandler serves the gRPC-Web requests, and their CORS preflight requests from the allowed origins,
+// with the gRPC server, so that they go through its interceptors. The other requests are passed to next,
+// which may be nil, so that gRPC-Web can share a port with the REST gateway.
+//
+// The request metadata, such as `authorization` and `x-api-key`, is sent as HTTP headers, and the response
+// metadata is exposed to the browser. gRPC-Web supports unary and server streaming RPCs, such as SearchLaptop,
+// but browsers cannot stream a request body, so the client streaming UploadImage and the bidirectional
+// RateLaptop cannot be called through gRPC-Web: browsers use the images and ratings routes of the REST gateway.
+func NewGRPCWebHandler(grpcServer *grpc.Server, allowedOrigins []string, next http.Handler) http.Handler {
+	if next == nil {
+		next = http.NotFoundHandler()
+	}
+
+	wrapped := grpcweb.WrapServer(
+		grpcServer,
+		grpcweb.WithOriginFunc(func(origin string) bool { return OriginAllowed(allowedOrigins, origin) }),
+		grpcweb.WithAllowedRequestHeaders(grpcWebCORSRequestHeaders),
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcWebFrame returns the length-prefixed frame of a gRPC-Web message
+func grpcWebFrame(t *testing.T, message proto.Message) []byte {
+	data, err := proto.Marshal(message)
+	require.NoError(t, err)
+
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func TestGRPCWebHandler(t *testing.T) {
+	t.Parallel()
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, nil, nil, policy, nil)
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(service.DefaultTenantID, laptop))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	pb.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(laptopStore, nil, nil, service.DefaultMaxImageSize, policy))
+
+	handler := service.NewGRPCWebHandler(grpcServer, []string{"https://pcbook.dev"}, nil)
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	searchURL := httpServer.URL + "/eshaanagg.pcbook.LaptopService/SearchLaptop"
+
+	// Only the allowed origins pass the preflight
+	for origin, allowed := range map[string]bool{"https://pcbook.dev": true, "https://evil.example": false} {
+		req, err := http.NewRequest(http.MethodOptions, searchURL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "x-grpc-web, content-type, authorization")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		if allowed {
+			require.Equal(t, origin, res.Header.Get("Access-Control-Allow-Origin"))
+		} else {
+			require.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+		}
+	}
+
+	search := func(token string) (*http.Response, []byte) {
+		body := grpcWebFrame(t, &pb.SearchLaptopRequest{Filter: &pb.Filter{MaxPriceUsd: 100000}})
+		req, err := http.NewRequest(http.MethodPost, searchURL, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("X-Grpc-Web", "1")
+		req.Header.Set("Origin", "https://pcbook.dev")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, data
+	}
+
+	res, _ := search("")
+	require.Equal(t, "16", res.Header.Get("Grpc-Status"))
+
+	user, err := service.NewUser("admin1", "secret", "admin", service.DefaultTenantID)
+	require.NoError(t, err)
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+
+	// The server streams a data frame for the laptop, then a trailer frame with the status
+	res, data := search(token)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "https://pcbook.dev", res.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, byte(0), data[0])
+	length := binary.BigEndian.Uint32(data[1:5])
+	found := &pb.SearchLaptopResponse{}
+	require.NoError(t, proto.Unmarshal(data[5:5+length], found))
+	require.Equal(t, laptop.GetId(), found.GetLaptop().GetId())
+
+	trailer := data[5+length:]
+	require.Equal(t, byte(0x80), trailer[0])
+	require.Equal(t, "grpc-status: 0\r\n", string(trailer[5:]))
+}
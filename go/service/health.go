@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Paths of the HTTP health probes
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// HealthChecker is a dependency, such as a store, whose health decides if a service can serve requests
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// HealthMonitor periodically checks the dependencies of each gRPC service, and publishes the results
+// through the standard grpc.health.v1 service. The overall status, with an empty service name,
+// is SERVING only when every service is.
+type HealthMonitor struct {
+	mutex        sync.RWMutex
+	healthServer *health.Server
+	checkers     map[string][]HealthChecker
+	// failures are the errors of the last check, by service
+	failures     map[string]error
+	shuttingDown bool
+}
+
+func NewHealthMonitor(healthServer *health.Server) *HealthMonitor {
+	return &HealthMonitor{
+		healthServer: healthServer,
+		checkers:     make(map[string][]HealthChecker),
+		failures:     make(map[string]error),
+	}
+}
+
+// Register adds the dependencies of a service. Services start as NOT_SERVING until they are checked.
+func (monitor *HealthMonitor) Register(service string, checkers ...HealthChecker) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.checkers[service] = append(monitor.checkers[service], checkers...)
+	monitor.failures[service] = errors.New("not checked yet")
+	monitor.healthServer.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	monitor.healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Check runs the checks of every service and updates their status
+func (monitor *HealthMonitor) Check() {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if monitor.shuttingDown {
+		return
+	}
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	for service, checkers := range monitor.checkers {
+		var errs []error
+		for _, checker := range checkers {
+			if err := checker.HealthCheck(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		status := healthpb.HealthCheckResponse_SERVING
+		monitor.failures[service] = errors.Join(errs...)
+		if len(errs) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			overall = status
+		}
+		monitor.healthServer.SetServingStatus(service, status)
+	}
+
+	monitor.healthServer.SetServingStatus("", overall)
+}
+
+// Watch checks the services at every interval until the context is done
+func (monitor *HealthMonitor) Watch(ctx context.Context, interval time.Duration) {
+	monitor.Check()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			monitor.Check()
+		}
+	}
+}
+
+// Ready returns an error describing the failing services, if any
+func (monitor *HealthMonitor) Ready() error {
+	monitor.mutex.RLock()
+	defer monitor.mutex.RUnlock()
+
+	if monitor.shuttingDown {
+		return errors.New("the server is shutting down")
+	}
+
+	services := make([]string, 0, len(monitor.failures))
+	for service, err := range monitor.failures {
+		if err != nil {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+
+	errs := make([]error, len(services))
+	for i, service := range services {
+		errs[i] = fmt.Errorf("%s: %w", service, monitor.failures[service])
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shutdown switches every service to NOT_SERVING for good
+func (monitor *HealthMonitor) Shutdown() {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.shuttingDown = true
+	monitor.healthServer.Shutdown()
+}
+
+// NewHealthHandler returns the HTTP probes: the liveness probe succeeds as long as the server responds,
+// while the readiness probe fails with 503 when a service is unhealthy or the server is shutting down
+func NewHealthHandler(monitor *HealthMonitor) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := monitor.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	return mux
+}
@@ -0,0 +1,85 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type fakeChecker struct {
+	err error
+}
+
+func (checker *fakeChecker) HealthCheck() error {
+	return checker.err
+}
+
+func TestHealthMonitor(t *testing.T) {
+	t.Parallel()
+
+	healthServer := health.NewServer()
+	monitor := service.NewHealthMonitor(healthServer)
+	imageStore := &fakeChecker{}
+	monitor.Register("LaptopService", service.NewInMemoryLaptopStore(), imageStore)
+	monitor.Register("AuthService", service.NewInMemoryUserStore())
+	handler := service.NewHealthHandler(monitor)
+
+	status := func(name string) healthpb.HealthCheckResponse_ServingStatus {
+		res, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+		require.NoError(t, err)
+		return res.GetStatus()
+	}
+	probe := func(path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	// Services are not ready until they are checked
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	require.Equal(t, http.StatusServiceUnavailable, probe(service.ReadinessPath))
+
+	monitor.Check()
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(""))
+	require.Equal(t, http.StatusOK, probe(service.ReadinessPath))
+
+	imageStore.err = errors.New("disk full")
+	monitor.Check()
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("LaptopService"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, status("AuthService"))
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	require.ErrorContains(t, monitor.Ready(), "LaptopService: disk full")
+	require.Equal(t, http.StatusServiceUnavailable, probe(service.ReadinessPath))
+	require.Equal(t, http.StatusOK, probe(service.LivenessPath))
+
+	// Once shutting down, the services stay NOT_SERVING even if they recover
+	imageStore.err = nil
+	monitor.Shutdown()
+	monitor.Check()
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("AuthService"))
+	require.Equal(t, http.StatusServiceUnavailable, probe(service.ReadinessPath))
+}
+
+func TestDiskImageStoreHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	imageStore := service.NewDiskImageStore(filepath.Join(t.TempDir(), "images"))
+	require.NoError(t, imageStore.HealthCheck())
+
+	// A file in place of the image folder makes the store unhealthy
+	blocked := filepath.Join(t.TempDir(), "images")
+	require.NoError(t, os.WriteFile(blocked, nil, 0600))
+	require.Error(t, service.NewDiskImageStore(blocked).HealthCheck())
+
+	require.NoError(t, imageStore.Close())
+	require.ErrorIs(t, imageStore.HealthCheck(), service.ErrClosed)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -11,20 +12,26 @@ import (
 
 // Interface that must be implemented by any image store
 type ImageStore interface {
-	Save(laptopId string, imageType string, imageData bytes.Buffer) (string, error)
+	Save(ctx context.Context, tenantID string, laptopId string, imageType string, imageData bytes.Buffer) (string, error)
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
 }
 
 type ImageInfo struct {
+	TenantID string
 	LaptopID string
 	Type     string
 	Path     string
 }
 
-// Creating an image store that resides on the disk
+// Creating an image store that resides on the disk, with the images of each tenant in their own sub folder
 type DiskImageStore struct {
 	mutex       sync.RWMutex
 	imageFolder string
 	images      map[string]*ImageInfo
+	// writes tracks the images being written, which Close waits for
+	writes sync.WaitGroup
+	closed bool
 }
 
 func NewDiskImageStore(imageFolder string) *DiskImageStore {
@@ -34,20 +41,47 @@ func NewDiskImageStore(imageFolder string) *DiskImageStore {
 	}
 }
 
-func (store *DiskImageStore) Save(laptopId string, imageType string, imageData bytes.Buffer) (string, error) {
+func (store *DiskImageStore) Save(ctx context.Context, tenantID string, laptopId string, imageType string, imageData bytes.Buffer) (string, error) {
+	err := ValidateTenantID(tenantID)
+	if err != nil {
+		return "", err
+	}
+
+	store.mutex.Lock()
+	if store.closed {
+		store.mutex.Unlock()
+		return "", ErrClosed
+	}
+	store.writes.Add(1)
+	store.mutex.Unlock()
+	defer store.writes.Done()
+
 	imageID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("cannot generate image id: %w", err)
 	}
 
-	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
+	tenantFolder := fmt.Sprintf("%s/%s", store.imageFolder, tenantID)
+	err = os.MkdirAll(tenantFolder, 0755)
+	if err != nil {
+		return "", fmt.Errorf("cannot create tenant image folder: %w", err)
+	}
+
+	imagePath := fmt.Sprintf("%s/%s%s", tenantFolder, imageID, imageType)
 	file, err := os.Create(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("cannot create image file: %w", err)
 	}
 
 	_, err = imageData.WriteTo(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(imagePath)
 		return "", fmt.Errorf("cannot write image to file: %w", err)
 	}
 
@@ -55,6 +89,7 @@ func (store *DiskImageStore) Save(laptopId string, imageType string, imageData b
 	defer store.mutex.Unlock()
 
 	store.images[imageID.String()] = &ImageInfo{
+		TenantID: tenantID,
 		LaptopID: laptopId,
 		Type:     imageType,
 		Path:     imagePath,
@@ -62,3 +97,30 @@ func (store *DiskImageStore) Save(laptopId string, imageType string, imageData b
 
 	return imageID.String(), nil
 }
+
+// Close waits for the images being written, and rejects new ones
+func (store *DiskImageStore) Close() error {
+	store.mutex.Lock()
+	store.closed = true
+	store.mutex.Unlock()
+
+	store.writes.Wait()
+	return nil
+}
+
+// HealthCheck verifies that new images can be written to the image folder
+func (store *DiskImageStore) HealthCheck() error {
+	store.mutex.RLock()
+	closed := store.closed
+	store.mutex.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	err := os.MkdirAll(store.imageFolder, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create image folder: %w", err)
+	}
+
+	return checkWritable(store.imageFolder)
+}
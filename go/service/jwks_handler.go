@@ -0,0 +1,32 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// JWKSPath is the well-known path at which the public signing keys are served
+const JWKSPath = "/.well-known/jwks.json"
+
+// NewJWKSHandler returns an HTTP handler that serves the public signing keys of the manager as a JWK set
+func NewJWKSHandler(jwtManager *JWTManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body := struct {
+			Keys []JSONWebKey `json:"keys"`
+		}{jwtManager.JWKS()}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		err := json.NewEncoder(w).Encode(body)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Cannot write the JWKS response", "error", err)
+		}
+	})
+}
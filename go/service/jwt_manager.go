@@ -1,33 +1,124 @@
 package service
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
+// SigningKey is an asymmetric key used by the JWTManager to sign and verify tokens
+type SigningKey struct {
+	// ID is published as the `kid` header of the tokens signed with this key
+	ID     string
+	Method jwt.SigningMethod
+	// PrivateKey is nil for keys that can only be used to verify tokens
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	// ActiveFrom is the time from which the key is used to sign new tokens
+	ActiveFrom time.Time
+	// ExpiresAt is the time after which the key is no longer accepted. Zero means no explicit expiry.
+	ExpiresAt time.Time
+}
+
 type JWTManager struct {
+	mutex sync.RWMutex
+	// secretKey is used for HS256 tokens when no asymmetric key is active
 	secretKey     string
+	keys          map[string]*SigningKey
 	tokenDuration time.Duration
 }
 
+// NewJWTManager returns a manager that signs tokens with HS256 using a shared secret
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
-	return &JWTManager{secretKey, tokenDuration}
+	return &JWTManager{
+		secretKey:     secretKey,
+		keys:          make(map[string]*SigningKey),
+		tokenDuration: tokenDuration,
+	}
+}
+
+// NewJWTManagerWithKeys returns a manager that signs tokens with asymmetric keys selected by their activation time
+func NewJWTManagerWithKeys(tokenDuration time.Duration, keys ...*SigningKey) (*JWTManager, error) {
+	manager := NewJWTManager("", tokenDuration)
+	for _, key := range keys {
+		err := manager.AddKey(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manager, nil
+}
+
+// AddKey registers a new key with the manager. Keys with a future activation time can be added ahead of a rotation.
+func (manager *JWTManager) AddKey(key *SigningKey) error {
+	if key.ID == "" {
+		return errors.New("signing key must have an id")
+	}
+	if key.PublicKey == nil || key.Method == nil {
+		return fmt.Errorf("signing key %s is missing a public key or signing method", key.ID)
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.keys[key.ID] != nil {
+		return fmt.Errorf("signing key %s: %w", key.ID, ErrAlreadyExists)
+	}
+
+	manager.keys[key.ID] = key
+	return nil
+}
+
+// RemoveKey removes a key, after which tokens signed with it are no longer accepted
+func (manager *JWTManager) RemoveKey(id string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	delete(manager.keys, id)
 }
 
 // Generate generates and signs a new token for a user
 func (manager *JWTManager) Generate(user *User) (string, error) {
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(manager.tokenDuration).Unix(),
-	})
+	claims := jwt.MapClaims{
+		"username":  user.Username,
+		"role":      user.Role,
+		"tenant_id": user.TenantID,
+		"exp":       time.Now().Add(manager.tokenDuration).Unix(),
+	}
+
+	manager.mutex.RLock()
+	key := manager.signingKey(time.Now())
+	manager.mutex.RUnlock()
+
+	var tokenString string
+	var err error
+	if key != nil {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		tokenString, err = token.SignedString(key.PrivateKey)
+	} else if manager.secretKey != "" {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err = token.SignedString([]byte(manager.secretKey))
+	} else {
+		err = errors.New("no active signing key")
+	}
 
-	tokenString, err := claims.SignedString([]byte(manager.secretKey))
 	if err != nil {
-		log.Printf("There was an error in signing the token: %v", err)
+		slog.Error("Cannot sign the token", "error", err)
 		return "", err
 	}
 
@@ -36,13 +127,7 @@ func (manager *JWTManager) Generate(user *User) (string, error) {
 
 // Verify verifies the access token string and return a user claim if the token is valid
 func (manager *JWTManager) Verify(accessToken string) (*User, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid token signing method")
-		}
-		return []byte(manager.secretKey), nil
-	})
-
+	token, err := jwt.Parse(accessToken, manager.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -52,8 +137,178 @@ func (manager *JWTManager) Verify(accessToken string) (*User, error) {
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
+	username, ok := claims["username"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims: missing username")
+	}
+	role, ok := claims["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims: missing role")
+	}
+
+	// Tokens issued before tenants were introduced belong to the default tenant
+	tenantID, _ := claims["tenant_id"].(string)
+	if tenantID == "" {
+		tenantID = DefaultTenantID
+	}
+
 	return &User{
-		Username: claims["username"].(string),
-		Role:     claims["role"].(string),
+		Username: username,
+		Role:     role,
+		TenantID: tenantID,
 	}, nil
 }
+
+// verificationKey selects the key to verify a token with, based on its `kid` header
+func (manager *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || manager.secretKey == "" {
+			return nil, fmt.Errorf("invalid token signing method")
+		}
+		return []byte(manager.secretKey), nil
+	}
+
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	key := manager.keys[kid]
+	if key == nil || manager.isRetired(key, time.Now()) {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("invalid token signing method")
+	}
+
+	return key.PublicKey, nil
+}
+
+// signingKey returns the most recently activated private key. The caller must hold the mutex.
+func (manager *JWTManager) signingKey(now time.Time) *SigningKey {
+	var current *SigningKey
+	for _, key := range manager.keys {
+		if key.PrivateKey == nil || key.ActiveFrom.After(now) || manager.isRetired(key, now) {
+			continue
+		}
+		if current == nil || key.ActiveFrom.After(current.ActiveFrom) {
+			current = key
+		}
+	}
+
+	return current
+}
+
+// isRetired reports whether a key should no longer be accepted. A signing key is retired
+// once a newer signing key has been active for longer than the token duration, as no token
+// signed with it can still be valid. The caller must hold the mutex.
+func (manager *JWTManager) isRetired(key *SigningKey, now time.Time) bool {
+	if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+		return true
+	}
+	if key.PrivateKey == nil {
+		return false
+	}
+
+	for _, other := range manager.keys {
+		if other.PrivateKey != nil &&
+			other.ActiveFrom.After(key.ActiveFrom) &&
+			now.After(other.ActiveFrom.Add(manager.tokenDuration)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JSONWebKey is the public part of a signing key in the JWK format
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys that are currently accepted, including keys scheduled for a future rotation
+func (manager *JWTManager) JWKS() []JSONWebKey {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	now := time.Now()
+	jwks := make([]JSONWebKey, 0, len(manager.keys))
+	for _, key := range manager.keys {
+		if manager.isRetired(key, now) {
+			continue
+		}
+
+		jwk := JSONWebKey{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+// LoadSigningKey reads a PEM encoded RSA or Ed25519 key from a file.
+// Private keys are used to sign tokens, while public keys can only be used to verify them.
+func LoadSigningKey(id string, filename string) (*SigningKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse key: %w", err)
+	}
+
+	key := &SigningKey{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", parsed)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTManagerAsymmetricKeys(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		privateKey interface{}
+		alg        string
+	}{
+		{name: "RS256", privateKey: rsaKey, alg: "RS256"},
+		{name: "EdDSA", privateKey: edKey, alg: "EdDSA"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := service.LoadSigningKey("key-1", writePrivateKey(t, tc.privateKey))
+			require.NoError(t, err)
+			require.Equal(t, tc.alg, key.Method.Alg())
+
+			manager, err := service.NewJWTManagerWithKeys(time.Minute, key)
+			require.NoError(t, err)
+
+			token, err := manager.Generate(&service.User{Username: "user1", Role: "user"})
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			require.Equal(t, "key-1", parsed.Header["kid"])
+			require.Equal(t, tc.alg, parsed.Method.Alg())
+
+			user, err := manager.Verify(token)
+			require.NoError(t, err)
+			require.Equal(t, "user1", user.Username)
+			require.Equal(t, "user", user.Role)
+
+			// Tokens signed by another manager with the same key id must be rejected
+			otherKey, err := service.LoadSigningKey("key-1", writePrivateKey(t, newPrivateKey(t, tc.privateKey)))
+			require.NoError(t, err)
+			other, err := service.NewJWTManagerWithKeys(time.Minute, otherKey)
+			require.NoError(t, err)
+			forged, err := other.Generate(&service.User{Username: "admin1", Role: "admin"})
+			require.NoError(t, err)
+			_, err = manager.Verify(forged)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestJWTManagerKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	oldKey, err := service.LoadSigningKey("old", writePrivateKey(t, newPrivateKey(t, ed25519.PrivateKey{})))
+	require.NoError(t, err)
+	newKey, err := service.LoadSigningKey("new", writePrivateKey(t, newPrivateKey(t, ed25519.PrivateKey{})))
+	require.NoError(t, err)
+	newKey.ActiveFrom = time.Now().Add(time.Hour)
+
+	manager, err := service.NewJWTManagerWithKeys(time.Minute, oldKey, newKey)
+	require.NoError(t, err)
+
+	// The scheduled key is published ahead of time but not yet used for signing
+	token, err := manager.Generate(&service.User{Username: "user1", Role: "user"})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	require.Equal(t, "old", parsed.Header["kid"])
+	require.Len(t, manager.JWKS(), 2)
+
+	// Once the new key has been active for longer than the token duration, the old key is retired
+	newKey.ActiveFrom = time.Now().Add(-2 * time.Minute)
+	_, err = manager.Verify(token)
+	require.Error(t, err)
+
+	token, err = manager.Generate(&service.User{Username: "user1", Role: "user"})
+	require.NoError(t, err)
+	_, err = manager.Verify(token)
+	require.NoError(t, err)
+
+	jwks := manager.JWKS()
+	require.Len(t, jwks, 1)
+	require.Equal(t, "new", jwks[0].Kid)
+}
+
+func TestJWKSHandler(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := service.LoadSigningKey("rsa-1", writePrivateKey(t, rsaKey))
+	require.NoError(t, err)
+	manager, err := service.NewJWTManagerWithKeys(time.Minute, key)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	service.NewJWKSHandler(manager).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, service.JWKSPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body struct {
+		Keys []service.JSONWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&body)
+	require.NoError(t, err)
+	require.Len(t, body.Keys, 1)
+	require.Equal(t, "RSA", body.Keys[0].Kty)
+	require.Equal(t, "RS256", body.Keys[0].Alg)
+	require.Equal(t, "AQAB", body.Keys[0].E)
+	require.NotEmpty(t, body.Keys[0].N)
+}
+
+func newPrivateKey(t *testing.T, like interface{}) interface{} {
+	if _, ok := like.(*rsa.PrivateKey); ok {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		return key
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func writePrivateKey(t *testing.T, key interface{}) string {
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0600)
+	require.NoError(t, err)
+
+	return path
+}
@@ -36,7 +36,7 @@ func TestClientCreateLaptop(t *testing.T) {
 	require.Equal(t, expectedId, res.Id)
 
 	// Check that the laptop is stored on the server (store)
-	fetchedLaptop, err := laptopSever.GetLaptopStore().Find(laptop.Id)
+	fetchedLaptop, err := laptopSever.GetLaptopStore().Find(service.DefaultTenantID, laptop.Id)
 	require.NoError(t, err)
 	require.NotNil(t, fetchedLaptop)
 	ensureSameLaptop(t, fetchedLaptop, laptop)
@@ -49,7 +49,7 @@ func TestClientSearchLaptop(t *testing.T) {
 		MaxPriceUsd: 2000,
 		MinCpuCores: 4,
 		MinCpuGhz:   2.2,
-		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_MEGABYTE},
+		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE},
 	}
 
 	store := service.NewInMemoryLaptopStore()
@@ -83,7 +83,7 @@ func TestClientSearchLaptop(t *testing.T) {
 			expectedIds[laptop.Id] = true
 		}
 
-		err := store.Save(laptop)
+		err := store.Save(service.DefaultTenantID, laptop)
 		require.NoError(t, err)
 	}
 
@@ -118,7 +118,7 @@ func TestClientUploadImage(t *testing.T) {
 	imageStore := service.NewDiskImageStore("../serializer/tmp")
 
 	laptop := sample.NewLaptop()
-	err := laptopStore.Save(laptop)
+	err := laptopStore.Save(service.DefaultTenantID, laptop)
 	require.NoError(t, err)
 
 	_, serverAddress := startTestLatopServer(t, laptopStore, imageStore, nil)
@@ -181,7 +181,7 @@ func TestClientRateLaptop(t *testing.T) {
 	ratingStore := service.NewInMemoryRatingStore()
 
 	laptop := sample.NewLaptop()
-	err := laptopStore.Save(laptop)
+	err := laptopStore.Save(service.DefaultTenantID, laptop)
 	require.NoError(t, err)
 
 	_, serverAddress := startTestLatopServer(t, laptopStore, nil, ratingStore)
@@ -228,9 +228,18 @@ func startTestLaptopClient(t *testing.T, serverAddress string) pb.LaptopServiceC
 }
 
 func startTestLatopServer(t *testing.T, laptopStore *service.InMemoryLaptopStore, imageStore *service.DiskImageStore, ratingStore *service.InMemoryRatingStore) (*service.LaptopServer, string) {
-	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
-
-	grpcServer := grpc.NewServer()
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore, service.DefaultMaxImageSize, nil)
+
+	// The requests are made by an admin, as modifying a laptop requires an authenticated user
+	admin := &service.User{Username: "admin1", Role: service.RoleAdmin, TenantID: service.DefaultTenantID}
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(service.ContextWithUser(ctx, admin), req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, &contextStream{ServerStream: stream, ctx: service.ContextWithUser(stream.Context(), admin)})
+		}),
+	)
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 
 	listener, err := net.Listen("tcp", ":0") // Assign it any random available port
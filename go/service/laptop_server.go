@@ -5,15 +5,17 @@ import (
 	"context"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 
 	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/validation"
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-const maxImageSize = 1 << 20
+// DefaultMaxImageSize is the default upload limit of laptop images, in bytes
+const DefaultMaxImageSize = 1 << 20
 
 // LaptopServer is the server that provides the laptop services
 type LaptopServer struct {
@@ -21,6 +23,10 @@ type LaptopServer struct {
 	laptopStore LaptopStore
 	imageStore  ImageStore
 	ratingStore RatingStore
+	// maxImageSize is the upload limit of laptop images, in bytes
+	maxImageSize int
+	// policy resolves the roles that inherit the admin rights, only the admin and super-admin roles have them if nil
+	policy PolicyProvider
 	// Embedded to have forward compatibility
 	pb.UnimplementedLaptopServiceServer
 }
@@ -30,11 +36,19 @@ func (server *LaptopServer) GetLaptopStore() LaptopStore {
 }
 
 // Returns a new LaptopServer
-func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *LaptopServer {
+func NewLaptopServer(
+	laptopStore LaptopStore,
+	imageStore ImageStore,
+	ratingStore RatingStore,
+	maxImageSize int,
+	policy PolicyProvider,
+) *LaptopServer {
 	return &LaptopServer{
-		laptopStore: laptopStore,
-		imageStore:  imageStore,
-		ratingStore: ratingStore,
+		laptopStore:  laptopStore,
+		imageStore:   imageStore,
+		ratingStore:  ratingStore,
+		maxImageSize: maxImageSize,
+		policy:       policy,
 	}
 }
 
@@ -42,16 +56,15 @@ func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore
 // It is a unary RPC to create a new laptop
 func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLaptopRequest) (*pb.CreateLaptopResponse, error) {
 	laptop := req.GetLaptop()
-	log.Printf("Recieved a CreateLaptop request with id: %s", laptop.Id)
+	slog.InfoContext(ctx, "Received a CreateLaptop request", "laptop_id", laptop.GetId())
 
-	// Check if the client has sent an ID
-	if len(laptop.Id) > 0 {
-		// Check if the sent UUID is valid
-		_, err := uuid.Parse(laptop.Id)
-		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "Laptop ID is not a valid UUID: %v", err)
-		}
-	} else {
+	// The violations are sent back as BadRequest details
+	if err := validation.ValidateLaptop(laptop); err != nil {
+		return nil, err
+	}
+
+	// Generate an ID if the client has not sent one
+	if len(laptop.Id) == 0 {
 		id, err := uuid.NewRandom()
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "Cannot generate a new laptop id: %v", err)
@@ -64,29 +77,62 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 		return nil, err
 	}
 
-	err := server.laptopStore.Save(laptop)
+	// Laptops created by an authenticated user are owned by them
+	owner := ""
+	if user, ok := UserFromContext(ctx); ok {
+		owner = user.Username
+	}
+
+	err := server.laptopStore.SaveWithOwner(tenantFromContext(ctx), laptop, owner)
 	if err != nil {
-		// Figure out the appropiate error code
-		code := codes.Internal
-		if errors.Is(err, ErrAlreadyExists) {
-			code = codes.AlreadyExists
-		}
-		return nil, status.Errorf(code, "Cannot save laptop to the store: %v", err)
+		return nil, statusErrorf(err, "Cannot save laptop to the store")
 	}
 
-	log.Printf("Saved laptop with the id: %v", laptop.Id)
+	slog.InfoContext(ctx, "Saved laptop", "laptop_id", laptop.Id)
 
 	return &pb.CreateLaptopResponse{
 		Id: laptop.Id,
 	}, nil
 }
 
+// UpdateLaptop is a unary RPC to replace an existing laptop
+func (server *LaptopServer) UpdateLaptop(ctx context.Context, req *pb.UpdateLaptopRequest) (*pb.UpdateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	slog.InfoContext(ctx, "Received an UpdateLaptop request", "laptop_id", laptop.GetId())
+
+	err := validation.ValidateLaptopUpdate(laptop)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizeOwner(ctx, laptop.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	err = server.laptopStore.Update(tenantFromContext(ctx), laptop)
+	if err != nil {
+		return nil, statusErrorf(err, "Cannot update laptop in the store")
+	}
+
+	slog.InfoContext(ctx, "Updated laptop", "laptop_id", laptop.Id)
+	return &pb.UpdateLaptopResponse{
+		Id: laptop.Id,
+	}, nil
+}
+
 func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.LaptopService_SearchLaptopServer) error {
+	ctx := stream.Context()
 	filter := req.GetFilter()
-	log.Printf("Recieved a SearchLaptop request with filter: %v", filter)
+	slog.InfoContext(ctx, "Received a SearchLaptop request", "filter", filter)
 
 	err := server.laptopStore.Search(
-		stream.Context(),
+		ctx,
+		tenantFromContext(ctx),
 		filter,
 		func(laptop *pb.Laptop) error {
 			res := &pb.SearchLaptopResponse{
@@ -98,39 +144,46 @@ func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.
 				return err
 			}
 
-			log.Printf("Sent laptop with id: %v", laptop.Id)
+			slog.DebugContext(ctx, "Sent laptop", "laptop_id", laptop.Id)
 			return nil
 		},
 	)
 
 	if err != nil {
-		return status.Errorf(codes.Internal, "unexpected error: %v", err)
+		return statusErrorf(err, "Cannot search for laptops")
 	}
 
 	return nil
 }
 
 func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
+	ctx := stream.Context()
 	// Handling the first stream packet as a meta-data packet
 	req, err := stream.Recv()
 	if err != nil {
-		log.Printf("Cannot recieve image info: %v", err)
+		slog.WarnContext(ctx, "Cannot receive image info", "error", err)
 		return status.Error(codes.Unknown, "cannot recieve image info")
 	}
 
 	laptopId := req.GetInfo().GetLaptopId()
 	imageType := req.GetInfo().GetImageType()
 
-	log.Printf("Recieved an upload image request for laptop %s with image type %s", laptopId, imageType)
+	slog.InfoContext(ctx, "Received an UploadImage request", "laptop_id", laptopId, "image_type", imageType)
 
-	laptop, err := server.laptopStore.Find(laptopId)
+	tenantID := tenantFromContext(ctx)
+	laptop, err := server.laptopStore.Find(tenantID, laptopId)
 	if err != nil {
-		log.Printf("There was an error in searching for the laptop")
-		return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+		slog.ErrorContext(ctx, "Cannot search for the laptop", "laptop_id", laptopId, "error", err)
+		return statusErrorf(err, "cannot find laptop")
 	}
 	if laptop == nil {
-		log.Printf("No laptop with the provided id (%s) was found to be stored.", laptopId)
-		return status.Errorf(codes.InvalidArgument, "No laptop exists with the id : %v", err)
+		slog.InfoContext(ctx, "No laptop was found", "laptop_id", laptopId)
+		return status.Errorf(codes.NotFound, "No laptop exists with the id: %s", laptopId)
+	}
+
+	err = server.authorizeOwner(ctx, laptopId)
+	if err != nil {
+		return err
 	}
 
 	imageData := bytes.Buffer{}
@@ -138,20 +191,20 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 
 	// Handle all the subsequent packets as image data packets
 	for {
-		if err := checkContextError(stream.Context()); err != nil {
+		if err := checkContextError(ctx); err != nil {
 			return err
 		}
 
-		log.Print("Waiting for chunk data")
+		slog.DebugContext(ctx, "Waiting for chunk data")
 
 		req, err := stream.Recv()
 		if err == io.EOF {
-			log.Print("Recieved all the image data")
+			slog.DebugContext(ctx, "Received all the image data")
 			break
 		}
 
 		if err != nil {
-			log.Printf("There was an error in recieving the stream data")
+			slog.WarnContext(ctx, "Cannot receive chunk data", "error", err)
 			return status.Errorf(codes.Unknown, "cannot recieve chunck data: %v", err)
 		}
 
@@ -159,24 +212,24 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 		size := len(chunk)
 		imageSize += size
 
-		log.Printf("Recieved chunk with size: %d", size)
+		slog.DebugContext(ctx, "Received chunk", "size", size)
 
-		if imageSize > maxImageSize {
-			log.Print("The sent image is too large.")
-			return status.Errorf(codes.InvalidArgument, "The send image is too large. The maximum upload limit is: %v", maxImageSize)
+		if imageSize > server.maxImageSize {
+			slog.InfoContext(ctx, "The sent image is too large", "size", imageSize, "max_size", server.maxImageSize)
+			return status.Errorf(codes.InvalidArgument, "The send image is too large. The maximum upload limit is: %v", server.maxImageSize)
 		}
 
 		_, err = imageData.Write(chunk)
 		if err != nil {
-			log.Print("Cannot append chunk to the image data")
+			slog.ErrorContext(ctx, "Cannot append chunk to the image data", "error", err)
 			return status.Errorf(codes.Internal, "Cannot append the sent chunk to the image data: %v", err)
 		}
 	}
 
-	imageId, err := server.imageStore.Save(laptopId, imageType, imageData)
+	imageId, err := server.imageStore.Save(ctx, tenantID, laptopId, imageType, imageData)
 	if err != nil {
-		log.Print("There was an error in storing the image to the disk")
-		return status.Errorf(codes.Internal, "Cannot save image to disk: %v", err)
+		slog.ErrorContext(ctx, "Cannot save the image", "laptop_id", laptopId, "error", err)
+		return statusErrorf(err, "Cannot save image to disk")
 	}
 
 	res := &pb.UploadImageResponse{
@@ -187,48 +240,52 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 	// Return a response to the client and close the stream
 	err = stream.SendAndClose(res)
 	if err != nil {
-		log.Fatal("Cannot close the stream.")
-		return status.Errorf(codes.Internal, "Cannot close the stream and send response: %v", err)
+		slog.WarnContext(ctx, "Cannot send the response", "error", err)
+		return statusErrorf(err, "Cannot close the stream and send response")
 	}
 
-	log.Printf("The image is successfully saved with id: %s and size: %v", imageId, imageSize)
+	slog.InfoContext(ctx, "Saved image", "image_id", imageId, "size", imageSize)
 	return nil
 }
 
 func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
+	ctx := stream.Context()
+	tenantID := tenantFromContext(ctx)
+
 	for {
-		err := checkContextError(stream.Context())
+		err := checkContextError(ctx)
 		if err != nil {
 			return err
 		}
 
 		req, err := stream.Recv()
 		if err == io.EOF {
-			log.Print("No more data to recieve.")
+			slog.DebugContext(ctx, "No more ratings to receive")
 			break
 		}
 
 		if err != nil {
-			log.Fatalf("Cannot recieve stream request: %v", err)
-			return status.Errorf(codes.Unknown, "Cannot recieve stream request: %v", err)
+			// The error already has a status code, such as ResourceExhausted for a throttled rating
+			slog.WarnContext(ctx, "Cannot receive stream request", "error", err)
+			return err
 		}
 
 		laptopId := req.GetLaptopId()
 		score := req.GetScore()
 
-		log.Printf("Recieved a RateLaptop request with id: %v, score = %.2f", laptopId, score)
+		slog.InfoContext(ctx, "Received a RateLaptop request", "laptop_id", laptopId, "score", score)
 
-		found, err := server.laptopStore.Find(laptopId)
+		found, err := server.laptopStore.Find(tenantID, laptopId)
 		if err != nil {
-			log.Fatalf("LaptoreStore.Find() function failed: %v", err)
-			return status.Errorf(codes.Internal, "LaptoreStore.Find() function failed: %v", err)
+			slog.ErrorContext(ctx, "Cannot find the rated laptop", "laptop_id", laptopId, "error", err)
+			return statusErrorf(err, "Cannot find the laptop")
 		}
 
 		if found == nil {
 			return status.Errorf(codes.NotFound, "There is no registered laptop with id: %v", laptopId)
 		}
 
-		rating := server.ratingStore.Add(laptopId, score)
+		rating := server.ratingStore.Add(ctx, tenantID, laptopId, score)
 		res := &pb.RateLaptopResponse{
 			LaptopId:     laptopId,
 			RatedCount:   rating.Count,
@@ -236,21 +293,56 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 		}
 		err = stream.Send(res)
 		if err != nil {
-			log.Fatalf("There was an error in sending the response: %v", err)
-			return status.Errorf(codes.Internal, "There was an error in streaming the response to the client: %v", err)
+			slog.WarnContext(ctx, "Cannot send the response", "error", err)
+			return statusErrorf(err, "There was an error in streaming the response to the client")
 		}
 	}
 
 	return nil
 }
 
+// authorizeOwner checks that the user of the request can modify the laptop. Admins, and the roles inheriting
+// from admin, can modify any laptop, while all other users, including vendors, can only modify the laptops they own.
+func (server *LaptopServer) authorizeOwner(ctx context.Context, laptopId string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "Modifying a laptop requires an authenticated user")
+	}
+	if server.isAdmin(user.Role) {
+		return nil
+	}
+
+	owner, err := server.laptopStore.Owner(tenantFromContext(ctx), laptopId)
+	if errors.Is(err, ErrNotFound) {
+		return status.Errorf(codes.NotFound, "There is no registered laptop with id: %v", laptopId)
+	}
+	if err != nil {
+		return statusErrorf(err, "Cannot find the owner of the laptop")
+	}
+
+	if owner != user.Username {
+		slog.WarnContext(ctx, "User tried to modify a laptop they do not own", "username", user.Username, "laptop_id", laptopId, "owner", owner)
+		return status.Errorf(codes.PermissionDenied, "The laptop %s is not owned by %s", laptopId, user.Username)
+	}
+
+	return nil
+}
+
+// isAdmin reports whether the role has the admin rights, itself or through the roles it inherits
+func (server *LaptopServer) isAdmin(role string) bool {
+	if server.policy == nil {
+		return role == RoleAdmin || role == RoleSuperAdmin
+	}
+	return server.policy.Policy().HasRole(role, RoleAdmin)
+}
+
 func checkContextError(ctx context.Context) error {
 	if ctx.Err() == context.Canceled {
-		log.Print("The request was cancelled")
+		slog.InfoContext(ctx, "The request was cancelled")
 		return status.Error(codes.Canceled, "The request was cancelled")
 	}
 	if ctx.Err() == context.DeadlineExceeded {
-		log.Print("Deadline for the request exceeded")
+		slog.InfoContext(ctx, "Deadline for the request exceeded")
 		return status.Error(codes.DeadlineExceeded, "Deadline exceeded")
 	}
 
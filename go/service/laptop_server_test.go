@@ -23,7 +23,7 @@ func TestServerCreateLaptop(t *testing.T) {
 
 	laptop := sample.NewLaptop()
 	store := service.NewInMemoryLaptopStore()
-	store.Save(laptop)
+	store.Save(service.DefaultTenantID, laptop)
 
 	testCases := []struct {
 		name   string
@@ -67,7 +67,7 @@ func TestServerCreateLaptop(t *testing.T) {
 				Laptop: tc.laptop,
 			}
 
-			server := service.NewLaptopServer(tc.store, nil, nil)
+			server := service.NewLaptopServer(tc.store, nil, nil, service.DefaultMaxImageSize, nil)
 
 			res, err := server.CreateLaptop(context.Background(), req)
 
@@ -88,3 +88,130 @@ func TestServerCreateLaptop(t *testing.T) {
 		})
 	}
 }
+
+func TestServerUpdateLaptopOwnership(t *testing.T) {
+	t.Parallel()
+
+	// The admin rights are also granted to the roles inheriting from admin
+	policy, err := service.ParsePolicy([]byte(`
+roles:
+  vendor: {}
+  admin:
+    inherits: [vendor]
+  manager:
+    inherits: [admin]
+`), "yaml")
+	require.NoError(t, err)
+	store := service.NewInMemoryLaptopStore()
+	server := service.NewLaptopServer(store, nil, nil, service.DefaultMaxImageSize, policy)
+
+	vendor1 := service.ContextWithUser(context.Background(), &service.User{Username: "vendor1", Role: service.RoleVendor})
+	vendor2 := service.ContextWithUser(context.Background(), &service.User{Username: "vendor2", Role: service.RoleVendor})
+	admin := service.ContextWithUser(context.Background(), &service.User{Username: "admin1", Role: service.RoleAdmin})
+	manager := service.ContextWithUser(context.Background(), &service.User{Username: "manager1", Role: "manager"})
+
+	laptop := sample.NewLaptop()
+	_, err = server.CreateLaptop(vendor1, &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	owner, err := store.Owner(service.DefaultTenantID, laptop.Id)
+	require.NoError(t, err)
+	require.Equal(t, "vendor1", owner)
+
+	testCases := []struct {
+		name   string
+		ctx    context.Context
+		laptop *pb.Laptop
+		code   codes.Code
+	}{
+		{
+			name:   "Owner can update",
+			ctx:    vendor1,
+			laptop: laptop,
+			code:   codes.OK,
+		},
+		{
+			name:   "Admin can update any laptop",
+			ctx:    admin,
+			laptop: laptop,
+			code:   codes.OK,
+		},
+		{
+			name:   "Role inheriting from admin can update any laptop",
+			ctx:    manager,
+			laptop: laptop,
+			code:   codes.OK,
+		},
+		{
+			name:   "Other vendor cannot update",
+			ctx:    vendor2,
+			laptop: laptop,
+			code:   codes.PermissionDenied,
+		},
+		{
+			name:   "Anonymous request cannot update",
+			ctx:    context.Background(),
+			laptop: laptop,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "Fail due to unknown laptop",
+			ctx:    admin,
+			laptop: sample.NewLaptop(),
+			code:   codes.NotFound,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := server.UpdateLaptop(tc.ctx, &pb.UpdateLaptopRequest{Laptop: tc.laptop})
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				require.Equal(t, tc.laptop.Id, res.Id)
+				return
+			}
+
+			require.Nil(t, res)
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, st.Code())
+		})
+	}
+
+	owner, err = store.Owner(service.DefaultTenantID, laptop.Id)
+	require.NoError(t, err)
+	require.Equal(t, "vendor1", owner)
+}
+
+func TestServerTenantIsolation(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	server := service.NewLaptopServer(store, nil, nil, service.DefaultMaxImageSize, nil)
+
+	acme := service.ContextWithUser(context.Background(), &service.User{Username: "vendor1", Role: service.RoleVendor, TenantID: "acme"})
+	globex := service.ContextWithUser(context.Background(), &service.User{Username: "vendor1", Role: service.RoleVendor, TenantID: "globex"})
+
+	laptop := sample.NewLaptop()
+	_, err := server.CreateLaptop(acme, &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	found, err := store.Find("acme", laptop.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+
+	// The same laptop ID is free in every other tenant
+	found, err = store.Find("globex", laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	found, err = store.Find(service.DefaultTenantID, laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	_, err = server.UpdateLaptop(globex, &pb.UpdateLaptopRequest{Laptop: laptop})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.CreateLaptop(globex, &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 
 	"github.com/eshaanagg/pcbook/go/pb"
@@ -12,33 +12,54 @@ import (
 )
 
 var ErrAlreadyExists = errors.New("record already exists in the store")
+var ErrNotFound = errors.New("record not found in the store")
+var ErrClosed = errors.New("the store is closed")
 
-// Define in an as interface, which can be implemented by multiple stores - InMemory, Database etc
+// Define in an as interface, which can be implemented by multiple stores - InMemory, Database etc.
+// Every operation is scoped to a tenant, and laptops of one tenant are never visible to another.
 type LaptopStore interface {
-	Save(laptop *pb.Laptop) error
-	Find(id string) (*pb.Laptop, error)
+	Save(tenantID string, laptop *pb.Laptop) error
+	// SaveWithOwner saves a new laptop and records the username of the user that owns it
+	SaveWithOwner(tenantID string, laptop *pb.Laptop, owner string) error
+	// Update replaces an existing laptop, keeping its owner
+	Update(tenantID string, laptop *pb.Laptop) error
+	Find(tenantID string, id string) (*pb.Laptop, error)
+	// Owner returns the username of the owner of the laptop, which is empty for laptops without an owner
+	Owner(tenantID string, id string) (string, error)
 	// A function to search for laptops with a filter, and returns each laptop one-by-one with the found callback function
-	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
+	Search(ctx context.Context, tenantID string, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
+}
+
+// laptopRecord is a stored laptop along with the username of its owner
+type laptopRecord struct {
+	laptop *pb.Laptop
+	owner  string
 }
 
 type InMemoryLaptopStore struct {
 	// To manage concurrency
 	mutex sync.RWMutex
-	// To store the data as key-value pairs
-	data map[string]*pb.Laptop
+	// To store the data as key-value pairs, partitioned by tenant
+	data map[string]map[string]*laptopRecord
 }
 
 func NewInMemoryLaptopStore() *InMemoryLaptopStore {
 	return &InMemoryLaptopStore{
-		data: make(map[string]*pb.Laptop),
+		data: make(map[string]map[string]*laptopRecord),
 	}
 }
 
-func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
+func (store *InMemoryLaptopStore) Save(tenantID string, laptop *pb.Laptop) error {
+	return store.SaveWithOwner(tenantID, laptop, "")
+}
+
+func (store *InMemoryLaptopStore) SaveWithOwner(tenantID string, laptop *pb.Laptop, owner string) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if store.data[laptop.Id] != nil {
+	if store.data[tenantID][laptop.Id] != nil {
 		return ErrAlreadyExists
 	}
 
@@ -47,30 +68,64 @@ func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
 		return err
 	}
 
-	store.data[other.Id] = other
+	if store.data[tenantID] == nil {
+		store.data[tenantID] = make(map[string]*laptopRecord)
+	}
+	store.data[tenantID][other.Id] = &laptopRecord{laptop: other, owner: owner}
+	return nil
+}
+
+func (store *InMemoryLaptopStore) Update(tenantID string, laptop *pb.Laptop) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	record := store.data[tenantID][laptop.Id]
+	if record == nil {
+		return ErrNotFound
+	}
+
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+
+	record.laptop = other
 	return nil
 }
 
-func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
+func (store *InMemoryLaptopStore) Find(tenantID string, id string) (*pb.Laptop, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	laptop := store.data[id]
-	if laptop == nil {
+	record := store.data[tenantID][id]
+	if record == nil {
 		return nil, nil
 	}
 
-	return deepCopy(laptop)
+	return deepCopy(record.laptop)
+}
+
+func (store *InMemoryLaptopStore) Owner(tenantID string, id string) (string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	record := store.data[tenantID][id]
+	if record == nil {
+		return "", ErrNotFound
+	}
+
+	return record.owner, nil
 }
 
-func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
+func (store *InMemoryLaptopStore) Search(ctx context.Context, tenantID string, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	for _, laptop := range store.data {
+	for _, record := range store.data[tenantID] {
+		laptop := record.laptop
 
 		if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
-			log.Print("The context is cancelled/timed out.")
+			slog.InfoContext(ctx, "The context is cancelled or timed out")
 			return errors.New("context is cancelled")
 		}
 
@@ -136,3 +191,8 @@ func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
 
 	return other, nil
 }
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryLaptopStore) HealthCheck() error {
+	return nil
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// LoginAttempts is the history of failed logins for a username or a peer address
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// LoginAttemptStore keeps the failed login attempts, so that they can be shared between server instances
+type LoginAttemptStore interface {
+	// Find returns nil if there is no failed attempt for the key
+	Find(key string) (*LoginAttempts, error)
+	Save(key string, attempts *LoginAttempts) error
+	Delete(key string) error
+	// Keys returns the keys of every stored attempt, so that the expired ones can be swept
+	Keys() ([]string, error)
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
+}
+
+// InMemoryLoginAttemptStore stores failed login attempts in memory
+type InMemoryLoginAttemptStore struct {
+	mutex    sync.RWMutex
+	attempts map[string]*LoginAttempts
+}
+
+// NewInMemoryLoginAttemptStore returns a new in-memory login attempt store
+func NewInMemoryLoginAttemptStore() *InMemoryLoginAttemptStore {
+	return &InMemoryLoginAttemptStore{
+		attempts: make(map[string]*LoginAttempts),
+	}
+}
+
+func (store *InMemoryLoginAttemptStore) Find(key string) (*LoginAttempts, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	attempts := store.attempts[key]
+	if attempts == nil {
+		return nil, nil
+	}
+
+	other := *attempts
+	return &other, nil
+}
+
+func (store *InMemoryLoginAttemptStore) Save(key string, attempts *LoginAttempts) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	other := *attempts
+	store.attempts[key] = &other
+	return nil
+}
+
+func (store *InMemoryLoginAttemptStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.attempts, key)
+	return nil
+}
+
+func (store *InMemoryLoginAttemptStore) Keys() ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys := make([]string, 0, len(store.attempts))
+	for key := range store.attempts {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// loginAttemptSweepInterval is how often the expired attempts are dropped, such as the ones of unknown usernames
+const loginAttemptSweepInterval = time.Minute
+
+// LoginLimiter throttles password guessing. Every failed login for a username or from a peer address
+// doubles the delay before the next attempt is allowed, and an account is locked after too many failures.
+// Locks and failure counts expire on their own after the lockout duration.
+type LoginLimiter struct {
+	// mutex serializes the read-modify-write cycles on the store
+	mutex           sync.Mutex
+	store           LoginAttemptStore
+	maxFailures     int
+	baseDelay       time.Duration
+	lockoutDuration time.Duration
+	// now returns the current time, the tests replace it to not depend on the wall time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewLoginLimiter(store LoginAttemptStore, maxFailures int, baseDelay time.Duration, lockoutDuration time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		store:           store,
+		maxFailures:     maxFailures,
+		baseDelay:       baseDelay,
+		lockoutDuration: lockoutDuration,
+		now:             time.Now,
+	}
+}
+
+// Check returns how long the client has to wait before it can attempt to login, or zero if it can login now
+func (limiter *LoginLimiter) Check(username string, peerAddress string) (time.Duration, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.wait(username, peerAddress, limiter.now())
+}
+
+// Reserve counts a login attempt as a failure before its password is checked, so that concurrent attempts cannot
+// all pass the check before the first failure is recorded. The account is locked once it reaches the maximum number
+// of failures. If the client has to wait, nothing is counted and the delay is returned. RecordSuccess undoes
+// the reservation of a successful login.
+func (limiter *LoginLimiter) Reserve(username string, peerAddress string) (time.Duration, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	err := limiter.sweep(now)
+	if err != nil {
+		return 0, err
+	}
+
+	wait, err := limiter.wait(username, peerAddress, now)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	for _, key := range loginAttemptKeys(username, peerAddress) {
+		attempts, err := limiter.find(key, now)
+		if err != nil {
+			return 0, err
+		}
+		if attempts == nil {
+			attempts = &LoginAttempts{}
+		}
+
+		attempts.Failures++
+		attempts.LastFailure = now
+		if key == userAttemptKey(username) && attempts.Failures >= limiter.maxFailures {
+			attempts.LockedUntil = now.Add(limiter.lockoutDuration)
+		}
+
+		err = limiter.store.Save(key, attempts)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+// RecordSuccess clears the failed attempts of the account after a successful login, and undoes the attempt
+// reserved for the peer address
+func (limiter *LoginLimiter) RecordSuccess(username string, peerAddress string) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	err := limiter.store.Delete(userAttemptKey(username))
+	if err != nil || peerAddress == "" {
+		return err
+	}
+
+	key := "peer:" + peerAddress
+	attempts, err := limiter.find(key, limiter.now())
+	if err != nil || attempts == nil {
+		return err
+	}
+	if attempts.Failures <= 1 {
+		return limiter.store.Delete(key)
+	}
+	attempts.Failures--
+	return limiter.store.Save(key, attempts)
+}
+
+// Unlock clears the failed attempts and the lock of an account
+func (limiter *LoginLimiter) Unlock(username string) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.store.Delete(userAttemptKey(username))
+}
+
+// IsLocked reports whether the account is currently locked
+func (limiter *LoginLimiter) IsLocked(username string) (bool, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	attempts, err := limiter.find(userAttemptKey(username), limiter.now())
+	if err != nil {
+		return false, err
+	}
+
+	return attempts != nil && !attempts.LockedUntil.IsZero(), nil
+}
+
+// wait returns the delay before the next login attempt is allowed. The caller must hold the mutex.
+func (limiter *LoginLimiter) wait(username string, peerAddress string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range loginAttemptKeys(username, peerAddress) {
+		attempts, err := limiter.find(key, now)
+		if err != nil {
+			return 0, err
+		}
+		if attempts == nil {
+			continue
+		}
+
+		allowedAt := attempts.LockedUntil
+		if allowedAt.IsZero() {
+			allowedAt = attempts.LastFailure.Add(limiter.backoff(attempts.Failures))
+		}
+		if delay := allowedAt.Sub(now); delay > wait {
+			wait = delay
+		}
+	}
+
+	return wait, nil
+}
+
+// sweep drops the expired attempts once per interval, as the attempts of the usernames and the peers
+// that are never seen again would otherwise be kept forever. The caller must hold the mutex.
+func (limiter *LoginLimiter) sweep(now time.Time) error {
+	if now.Sub(limiter.lastSweep) < loginAttemptSweepInterval {
+		return nil
+	}
+
+	keys, err := limiter.store.Keys()
+	if err != nil {
+		return fmt.Errorf("cannot list login attempts: %w", err)
+	}
+	for _, key := range keys {
+		// find deletes the attempts that have expired
+		if _, err := limiter.find(key, now); err != nil {
+			return err
+		}
+	}
+	limiter.lastSweep = now
+	return nil
+}
+
+// find returns the attempts for the key, discarding the ones that have expired. The caller must hold the mutex.
+func (limiter *LoginLimiter) find(key string, now time.Time) (*LoginAttempts, error) {
+	attempts, err := limiter.store.Find(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find login attempts: %w", err)
+	}
+	if attempts == nil {
+		return nil, nil
+	}
+
+	expired := now.After(attempts.LastFailure.Add(limiter.lockoutDuration))
+	if !attempts.LockedUntil.IsZero() {
+		expired = now.After(attempts.LockedUntil)
+	}
+	if expired {
+		return nil, limiter.store.Delete(key)
+	}
+
+	return attempts, nil
+}
+
+// backoff returns the delay to wait after the given number of consecutive failures
+func (limiter *LoginLimiter) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	delay := float64(limiter.baseDelay) * math.Pow(2, float64(failures-1))
+	if delay > float64(limiter.lockoutDuration) {
+		return limiter.lockoutDuration
+	}
+
+	return time.Duration(delay)
+}
+
+func loginAttemptKeys(username string, peerAddress string) []string {
+	keys := []string{userAttemptKey(username)}
+	if peerAddress != "" {
+		keys = append(keys, "peer:"+peerAddress)
+	}
+
+	return keys
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+// peerAddress returns the IP address of the client of the request, without its port
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if address, ok := forwardedAddress(ctx, p); ok {
+		return address
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// setRetryAfter tells the client how long to wait before retrying through the `retry-after` response header.
+// It is also sent in the trailer, as the header may already be sent when a stream is throttled.
+func setRetryAfter(ctx context.Context, delay time.Duration) {
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	// Fails only if the handler is not called by a gRPC server, in which case there is nobody to tell
+	retryAfter := metadata.Pairs("retry-after", strconv.Itoa(seconds))
+	_ = grpc.SetHeader(ctx, retryAfter)
+	_ = grpc.SetTrailer(ctx, retryAfter)
+}
+
+// retryError returns a ResourceExhausted status error with a RetryInfo detail, and a QuotaFailure detail
+// if the quota that is exceeded is given. The delay is also sent through setRetryAfter.
+func retryError(ctx context.Context, delay time.Duration, quota *errdetails.QuotaFailure_Violation, message string) error {
+	setRetryAfter(ctx, delay)
+
+	st := status.New(codes.ResourceExhausted, message)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err == nil && quota != nil {
+		detailed, err = detailed.WithDetails(&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{quota}})
+	}
+	if err != nil {
+		// Only fails if a detail cannot be marshalled, the message and the retry-after metadata remain
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryLoginAttemptStore) HealthCheck() error {
+	return nil
+}
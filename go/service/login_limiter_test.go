@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginLockout(t *testing.T) {
+	t.Parallel()
+
+	userStore := service.NewInMemoryUserStore()
+	err := service.CreateUser(userStore, "user1", "secret", "user", service.DefaultTenantID)
+	require.NoError(t, err)
+
+	clock := newTestClock()
+	limiter := service.NewLoginLimiter(service.NewInMemoryLoginAttemptStore(), 3, 0, 200*time.Millisecond)
+	limiter.SetClock(clock.Now)
+	authServer := service.NewAuthServer(userStore, nil, nil, limiter, service.NewJWTManager("secret", time.Minute), nil, nil)
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	authClient := pb.NewAuthServiceClient(conn)
+
+	login := func(password string) (metadata.MD, error) {
+		var header metadata.MD
+		_, err := authClient.Login(context.Background(), &pb.LoginRequest{Username: "user1", Password: password}, grpc.Header(&header))
+		return header, err
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := login("wrong")
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+
+	// The account is locked, even for the correct password
+	header, err := login("secret")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"1"}, header.Get("retry-after"))
+
+	locked, err := limiter.IsLocked("user1")
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	// The lock expires on its own
+	clock.Advance(250 * time.Millisecond)
+	_, err = login("secret")
+	require.NoError(t, err)
+
+	// An admin can unlock the account before the lock expires
+	for i := 0; i < 3; i++ {
+		_, err := login("wrong")
+		require.Error(t, err)
+	}
+	_, err = authServer.UnlockUser(context.Background(), &pb.UnlockUserRequest{Username: "user1"})
+	require.NoError(t, err)
+	_, err = login("secret")
+	require.NoError(t, err)
+}
+
+func TestLoginBackoff(t *testing.T) {
+	t.Parallel()
+
+	clock := newTestClock()
+	limiter := service.NewLoginLimiter(service.NewInMemoryLoginAttemptStore(), 10, 100*time.Millisecond, time.Minute)
+	limiter.SetClock(clock.Now)
+
+	wait, err := limiter.Check("user1", "10.0.0.1")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			clock.Advance(time.Duration(100<<(i-1)) * time.Millisecond)
+		}
+		wait, err = limiter.Reserve("user1", "10.0.0.1")
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+
+	// The delay doubles with every failure
+	wait, err = limiter.Check("user1", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, 400*time.Millisecond, wait)
+
+	// Nothing is reserved while the client has to wait
+	wait, err = limiter.Reserve("user1", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, 400*time.Millisecond, wait)
+
+	// The failures from the peer address also throttle other usernames
+	wait, err = limiter.Check("user2", "10.0.0.1")
+	require.NoError(t, err)
+	require.NotZero(t, wait)
+
+	wait, err = limiter.Check("user2", "10.0.0.2")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// A successful login undoes its reservation
+	clock.Advance(400 * time.Millisecond)
+	_, err = limiter.Reserve("user1", "10.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, limiter.RecordSuccess("user1", "10.0.0.1"))
+	wait, err = limiter.Check("user1", "10.0.0.2")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	wait, err = limiter.Check("user2", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, 400*time.Millisecond, wait)
+}
+
+func TestLoginConcurrentAttempts(t *testing.T) {
+	t.Parallel()
+
+	limiter := service.NewLoginLimiter(service.NewInMemoryLoginAttemptStore(), 3, time.Minute, time.Hour)
+
+	// Only one of the concurrent attempts passes before the backoff applies
+	const attempts = 20
+	var wg sync.WaitGroup
+	allowed := make(chan struct{}, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Reserve("user1", "10.0.0.1")
+			if err == nil && wait == 0 {
+				allowed <- struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, allowed, 1)
+}
+
+func TestLoginAttemptSweep(t *testing.T) {
+	t.Parallel()
+
+	clock := newTestClock()
+	store := service.NewInMemoryLoginAttemptStore()
+	limiter := service.NewLoginLimiter(store, 3, 0, time.Second)
+	limiter.SetClock(clock.Now)
+
+	for i := 0; i < 10; i++ {
+		_, err := limiter.Reserve(fmt.Sprintf("unknown%d", i), fmt.Sprintf("10.0.0.%d", i))
+		require.NoError(t, err)
+	}
+	keys, err := store.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 20)
+
+	// The expired attempts are dropped without being read again
+	clock.Advance(2 * time.Minute)
+	_, err = limiter.Reserve("user1", "10.0.0.100")
+	require.NoError(t, err)
+	keys, err = store.Keys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"user:user1", "peer:10.0.0.100"}, keys)
+}
+
+// testClock is a clock that only moves when the test advances it
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (clock *testClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+func (clock *testClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(d)
+}
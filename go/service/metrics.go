@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsPath is the path of the Prometheus endpoint
+const MetricsPath = "/metrics"
+
+// Metrics records the RPC and domain metrics of the server in its own Prometheus registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	handled        *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	inFlight       *prometheus.GaugeVec
+	streamMessages *prometheus.CounterVec
+
+	laptopsStored    prometheus.Counter
+	imagesStored     prometheus.Counter
+	imageBytes       prometheus.Counter
+	ratingsSubmitted prometheus.Counter
+	loginFailures    *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pcbook_grpc_requests_total",
+			Help: "Number of RPCs completed, by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pcbook_grpc_request_duration_seconds",
+			Help:    "Duration of the RPCs, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pcbook_grpc_requests_in_flight",
+			Help: "Number of RPCs being handled, by method.",
+		}, []string{"method"}),
+		streamMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pcbook_grpc_stream_messages_total",
+			Help: "Number of messages received or sent on streams, by method and direction.",
+		}, []string{"method", "direction"}),
+		laptopsStored: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pcbook_laptops_stored_total",
+			Help: "Number of laptops saved to the laptop store.",
+		}),
+		imagesStored: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pcbook_images_stored_total",
+			Help: "Number of laptop images saved to the image store.",
+		}),
+		imageBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pcbook_image_uploaded_bytes_total",
+			Help: "Size of the laptop images saved to the image store, in bytes.",
+		}),
+		ratingsSubmitted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pcbook_ratings_submitted_total",
+			Help: "Number of laptop ratings added to the rating store.",
+		}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pcbook_login_failures_total",
+			Help: "Number of failed logins, by status code.",
+		}, []string{"code"}),
+	}
+
+	metrics.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.handled,
+		metrics.latency,
+		metrics.inFlight,
+		metrics.streamMessages,
+		metrics.laptopsStored,
+		metrics.imagesStored,
+		metrics.imageBytes,
+		metrics.ratingsSubmitted,
+		metrics.loginFailures,
+	)
+
+	return metrics
+}
+
+// Handler returns the HTTP handler exposing the metrics in the Prometheus text format
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{Registry: metrics.registry})
+}
+
+// Unary returns a server interceptor function to record the metrics of unary RPC.
+// It must come before the AuthInterceptor in the chain, so that denied calls are counted as well.
+func (metrics *Metrics) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		done := metrics.start(info.FullMethod)
+		res, err := handler(ctx, req)
+		done(err)
+		return res, err
+	}
+}
+
+// Stream returns a server interceptor function to record the metrics of stream RPC, including the number of messages
+func (metrics *Metrics) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		done := metrics.start(info.FullMethod)
+		err := handler(srv, &measuredStream{ServerStream: stream, metrics: metrics, method: info.FullMethod})
+		done(err)
+		return err
+	}
+}
+
+// start records the beginning of a call, and returns the function recording its end
+func (metrics *Metrics) start(method string) func(err error) {
+	startTime := time.Now()
+	inFlight := metrics.inFlight.WithLabelValues(method)
+	inFlight.Inc()
+
+	return func(err error) {
+		inFlight.Dec()
+		code := status.Code(err).String()
+		metrics.handled.WithLabelValues(method, code).Inc()
+		metrics.latency.WithLabelValues(method).Observe(time.Since(startTime).Seconds())
+		if method == loginMethod && err != nil {
+			metrics.loginFailures.WithLabelValues(code).Inc()
+		}
+	}
+}
+
+type measuredStream struct {
+	grpc.ServerStream
+	metrics *Metrics
+	method  string
+}
+
+func (stream *measuredStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err == nil {
+		stream.metrics.streamMessages.WithLabelValues(stream.method, "received").Inc()
+	}
+	return err
+}
+
+func (stream *measuredStream) SendMsg(m interface{}) error {
+	err := stream.ServerStream.SendMsg(m)
+	if err == nil {
+		stream.metrics.streamMessages.WithLabelValues(stream.method, "sent").Inc()
+	}
+	return err
+}
+
+// LaptopStore returns the store counting the laptops it saves
+func (metrics *Metrics) LaptopStore(store LaptopStore) LaptopStore {
+	return &measuredLaptopStore{store, metrics}
+}
+
+// ImageStore returns the store counting the images it saves and their size
+func (metrics *Metrics) ImageStore(store ImageStore) ImageStore {
+	return &measuredImageStore{store, metrics}
+}
+
+// RatingStore returns the store counting the ratings added to it
+func (metrics *Metrics) RatingStore(store RatingStore) RatingStore {
+	return &measuredRatingStore{store, metrics}
+}
+
+type measuredLaptopStore struct {
+	LaptopStore
+	metrics *Metrics
+}
+
+func (store *measuredLaptopStore) Save(tenantID string, laptop *pb.Laptop) error {
+	err := store.LaptopStore.Save(tenantID, laptop)
+	if err == nil {
+		store.metrics.laptopsStored.Inc()
+	}
+	return err
+}
+
+func (store *measuredLaptopStore) SaveWithOwner(tenantID string, laptop *pb.Laptop, owner string) error {
+	err := store.LaptopStore.SaveWithOwner(tenantID, laptop, owner)
+	if err == nil {
+		store.metrics.laptopsStored.Inc()
+	}
+	return err
+}
+
+type measuredImageStore struct {
+	ImageStore
+	metrics *Metrics
+}
+
+func (store *measuredImageStore) Save(ctx context.Context, tenantID string, laptopId string, imageType string, imageData bytes.Buffer) (string, error) {
+	size := imageData.Len()
+	imageID, err := store.ImageStore.Save(ctx, tenantID, laptopId, imageType, imageData)
+	if err == nil {
+		store.metrics.imagesStored.Inc()
+		store.metrics.imageBytes.Add(float64(size))
+	}
+	return imageID, err
+}
+
+type measuredRatingStore struct {
+	RatingStore
+	metrics *Metrics
+}
+
+func (store *measuredRatingStore) Add(ctx context.Context, tenantID string, laptopId string, score float64) *Rating {
+	rating := store.RatingStore.Add(ctx, tenantID, laptopId, score)
+	store.metrics.ratingsSubmitted.Inc()
+	return rating
+}
@@ -0,0 +1,65 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := service.NewMetrics()
+	laptopServer := service.NewLaptopServer(
+		metrics.LaptopStore(service.NewInMemoryLaptopStore()),
+		nil,
+		metrics.RatingStore(service.NewInMemoryRatingStore()),
+		service.DefaultMaxImageSize,
+		nil,
+	)
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(metrics.Unary()),
+		grpc.ChainStreamInterceptor(metrics.Stream()),
+	)
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	laptopClient := startTestLaptopClient(t, listener.Addr().String())
+	laptop := sample.NewLaptop()
+	_, err = laptopClient.CreateLaptop(context.Background(), &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	stream, err := laptopClient.RateLaptop(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.Id, Score: 8}))
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, service.MetricsPath, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body := recorder.Body.String()
+	require.Contains(t, body, `pcbook_grpc_requests_total{code="OK",method="/eshaanagg.pcbook.LaptopService/CreateLaptop"} 1`)
+	require.Contains(t, body, `pcbook_grpc_stream_messages_total{direction="received",method="/eshaanagg.pcbook.LaptopService/RateLaptop"} 1`)
+	require.Contains(t, body, `pcbook_grpc_stream_messages_total{direction="sent",method="/eshaanagg.pcbook.LaptopService/RateLaptop"} 1`)
+	require.Contains(t, body, `pcbook_grpc_requests_in_flight{method="/eshaanagg.pcbook.LaptopService/CreateLaptop"} 0`)
+	require.Contains(t, body, "pcbook_laptops_stored_total 1")
+	require.Contains(t, body, "pcbook_ratings_submitted_total 1")
+}
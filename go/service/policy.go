@@ -0,0 +1,283 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyProvider returns the authorization policy to evaluate for a request
+type PolicyProvider interface {
+	Policy() *Policy
+}
+
+// RoleDefinition declares a role and the roles whose permissions it inherits
+type RoleDefinition struct {
+	Inherits []string `json:"inherits" yaml:"inherits"`
+}
+
+// PolicyRule grants the listed roles access to every method matching one of the patterns
+type PolicyRule struct {
+	Methods []string `json:"methods" yaml:"methods"`
+	Roles   []string `json:"roles" yaml:"roles"`
+}
+
+// Policy is a deny-by-default authorization policy. A method can only be called anonymously if it
+// is in the anonymous allow-list, and by an authenticated user if a rule grants access to the user's role.
+// Method patterns use the syntax of path.Match, so `/eshaanagg.pcbook.LaptopService/*` matches every
+// method of the service, while `*` matches any method.
+type Policy struct {
+	Roles     map[string]RoleDefinition `json:"roles" yaml:"roles"`
+	Anonymous []string                  `json:"anonymous" yaml:"anonymous"`
+	Rules     []PolicyRule              `json:"rules" yaml:"rules"`
+
+	// effectiveRoles maps each role to itself and all the roles it inherits from
+	effectiveRoles map[string]map[string]bool
+}
+
+// ParsePolicy decodes and validates a JSON or YAML policy
+func ParsePolicy(data []byte, format string) (*Policy, error) {
+	policy := &Policy{}
+
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(policy); err != nil {
+			return nil, fmt.Errorf("cannot decode JSON policy: %w", err)
+		}
+	case "yaml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(policy); err != nil {
+			return nil, fmt.Errorf("cannot decode YAML policy: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported policy format: %s", format)
+	}
+
+	err := policy.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// LoadPolicy reads a policy file, whose format is chosen by its extension
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+
+	format := "yaml"
+	if filepath.Ext(filename) == ".json" {
+		format = "json"
+	}
+
+	return ParsePolicy(data, format)
+}
+
+// Policy returns the policy itself, so that a static policy can be used as a PolicyProvider
+func (policy *Policy) Policy() *Policy {
+	return policy
+}
+
+// IsAnonymous reports whether the method can be called without any credentials
+func (policy *Policy) IsAnonymous(method string) bool {
+	for _, pattern := range policy.Anonymous {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether a user with the role is allowed to call the method
+func (policy *Policy) Allows(role string, method string) bool {
+	roles := policy.effectiveRoles[role]
+	if roles == nil {
+		return false
+	}
+
+	for _, rule := range policy.Rules {
+		if !rule.matches(method) {
+			continue
+		}
+		for _, allowed := range rule.Roles {
+			if roles[allowed] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DefinesRole reports whether the role is declared by the policy
+func (policy *Policy) DefinesRole(role string) bool {
+	_, ok := policy.Roles[role]
+	return ok
+}
+
+// HasRole reports whether the role is the other role, or inherits from it
+func (policy *Policy) HasRole(role string, other string) bool {
+	return policy.effectiveRoles[role][other]
+}
+
+func (rule *PolicyRule) matches(method string) bool {
+	for _, pattern := range rule.Methods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchMethod(pattern string, method string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, method)
+	return matched
+}
+
+// compile validates the policy and resolves the role hierarchy
+func (policy *Policy) compile() error {
+	for _, pattern := range policy.Anonymous {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid anonymous method pattern %q: %w", pattern, err)
+		}
+	}
+
+	for i, rule := range policy.Rules {
+		if len(rule.Methods) == 0 || len(rule.Roles) == 0 {
+			return fmt.Errorf("rule %d must list at least one method and one role", i)
+		}
+		for _, pattern := range rule.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d has an invalid method pattern %q: %w", i, pattern, err)
+			}
+		}
+		for _, role := range rule.Roles {
+			if _, ok := policy.Roles[role]; !ok {
+				return fmt.Errorf("rule %d references the undefined role %q", i, role)
+			}
+		}
+	}
+
+	policy.effectiveRoles = make(map[string]map[string]bool)
+	for role := range policy.Roles {
+		roles := make(map[string]bool)
+		err := policy.inherit(role, roles, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		policy.effectiveRoles[role] = roles
+	}
+
+	return nil
+}
+
+// inherit adds the role and all of its ancestors to roles, detecting cycles in the hierarchy
+func (policy *Policy) inherit(role string, roles map[string]bool, visiting map[string]bool) error {
+	definition, ok := policy.Roles[role]
+	if !ok {
+		return fmt.Errorf("undefined role %q", role)
+	}
+	if visiting[role] {
+		return fmt.Errorf("role %q inherits from itself", role)
+	}
+
+	visiting[role] = true
+	defer delete(visiting, role)
+
+	roles[role] = true
+	for _, parent := range definition.Inherits {
+		err := policy.inherit(parent, roles, visiting)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PolicyWatcher serves a policy loaded from a file, and reloads it whenever the file changes
+type PolicyWatcher struct {
+	filename string
+	current  atomic.Pointer[Policy]
+	modTime  time.Time
+}
+
+// NewPolicyWatcher loads the policy file, failing if it is missing or invalid
+func NewPolicyWatcher(filename string) (*PolicyWatcher, error) {
+	watcher := &PolicyWatcher{filename: filename}
+
+	_, err := watcher.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+func (watcher *PolicyWatcher) Policy() *Policy {
+	return watcher.current.Load()
+}
+
+// Watch polls the policy file until the context is done. An invalid policy is logged and ignored,
+// so that the last valid policy stays in effect.
+func (watcher *PolicyWatcher) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := watcher.reload()
+			if err != nil {
+				slog.ErrorContext(ctx, "Cannot reload the policy file", "file", watcher.filename, "error", err)
+			} else if reloaded {
+				slog.InfoContext(ctx, "Reloaded the policy file", "file", watcher.filename)
+			}
+		}
+	}
+}
+
+// reload loads the policy file if it was modified since it was last read
+func (watcher *PolicyWatcher) reload() (bool, error) {
+	info, err := os.Stat(watcher.filename)
+	if err != nil {
+		return false, fmt.Errorf("cannot stat policy file: %w", err)
+	}
+	if info.ModTime().Equal(watcher.modTime) {
+		return false, nil
+	}
+
+	// Remember the modification time even if the policy is invalid, so that the error is only reported once
+	watcher.modTime = info.ModTime()
+
+	policy, err := LoadPolicy(watcher.filename)
+	if err != nil {
+		return false, err
+	}
+
+	watcher.current.Store(policy)
+	return true, nil
+}
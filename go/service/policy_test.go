@@ -0,0 +1,140 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+roles:
+  user: {}
+  editor:
+    inherits: [user]
+  admin:
+    inherits: [editor]
+anonymous:
+  - /eshaanagg.pcbook.AuthService/Login
+rules:
+  - methods: [/eshaanagg.pcbook.LaptopService/*]
+    roles: [admin]
+  - methods: [/eshaanagg.pcbook.LaptopService/UploadImage]
+    roles: [editor]
+  - methods: [/eshaanagg.pcbook.LaptopService/RateLaptop]
+    roles: [user]
+`
+
+func TestPolicyAllows(t *testing.T) {
+	t.Parallel()
+
+	policy, err := service.ParsePolicy([]byte(testPolicy), "yaml")
+	require.NoError(t, err)
+
+	const laptopServicePath = "/eshaanagg.pcbook.LaptopService/"
+	testCases := []struct {
+		role    string
+		method  string
+		allowed bool
+	}{
+		{"admin", laptopServicePath + "CreateLaptop", true},
+		{"admin", laptopServicePath + "RateLaptop", true},
+		{"editor", laptopServicePath + "UploadImage", true},
+		{"editor", laptopServicePath + "RateLaptop", true},
+		{"editor", laptopServicePath + "CreateLaptop", false},
+		{"user", laptopServicePath + "RateLaptop", true},
+		{"user", laptopServicePath + "UploadImage", false},
+		{"guest", laptopServicePath + "RateLaptop", false},
+		{"admin", "/eshaanagg.pcbook.AuthService/Unlisted", false},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.allowed, policy.Allows(tc.role, tc.method), "%s calling %s", tc.role, tc.method)
+	}
+
+	require.True(t, policy.IsAnonymous("/eshaanagg.pcbook.AuthService/Login"))
+	require.False(t, policy.IsAnonymous(laptopServicePath+"SearchLaptop"))
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		policy string
+		format string
+	}{
+		{
+			name:   "Inheritance cycle",
+			policy: `{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}}`,
+			format: "json",
+		},
+		{
+			name:   "Undefined parent role",
+			policy: `{"roles": {"a": {"inherits": ["b"]}}}`,
+			format: "json",
+		},
+		{
+			name:   "Rule with an undefined role",
+			policy: "roles: {user: {}}\nrules: [{methods: ['*'], roles: [admin]}]",
+			format: "yaml",
+		},
+		{
+			name:   "Invalid method pattern",
+			policy: "roles: {user: {}}\nanonymous: ['/a/[']",
+			format: "yaml",
+		},
+		{
+			name:   "Unknown field",
+			policy: "roles: {user: {}}\nallow: ['*']",
+			format: "yaml",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := service.ParsePolicy([]byte(tc.policy), tc.format)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPolicyWatcherReload(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(filename, []byte(testPolicy), 0644)
+	require.NoError(t, err)
+
+	watcher, err := service.NewPolicyWatcher(filename)
+	require.NoError(t, err)
+	require.False(t, watcher.Policy().IsAnonymous("/eshaanagg.pcbook.LaptopService/SearchLaptop"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Watch(ctx, 10*time.Millisecond)
+
+	// An invalid policy keeps the previous one in effect
+	err = os.WriteFile(filename, []byte("roles: ["), 0644)
+	require.NoError(t, err)
+	err = os.Chtimes(filename, time.Now(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, watcher.Policy().Allows("user", "/eshaanagg.pcbook.LaptopService/RateLaptop"))
+
+	err = os.WriteFile(filename, []byte(testPolicy+"  - methods: [/eshaanagg.pcbook.LaptopService/SearchLaptop]\n    roles: [user]\n"), 0644)
+	require.NoError(t, err)
+	err = os.Chtimes(filename, time.Now(), time.Now().Add(2*time.Second))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return watcher.Policy().Allows("user", "/eshaanagg.pcbook.LaptopService/SearchLaptop")
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+)
+
+// rateLimitSweepInterval is how often the buckets that are full again are dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is the token bucket budget of every caller of the matching methods
+type RateLimit struct {
+	// Method is a pattern with the syntax of path.Match, such as `/eshaanagg.pcbook.LaptopService/*`
+	Method string
+	// Rate is the number of calls, or of messages of bidirectional streams, allowed per second
+	Rate float64
+	// Burst is the number of calls allowed at once
+	Burst int
+}
+
+// RateLimiter throttles the calls of each user, or of each peer IP address for anonymous calls,
+// with the budget of the first limit matching the method. Methods without a limit are not throttled.
+type RateLimiter struct {
+	limits []RateLimit
+
+	mutex     sync.Mutex
+	buckets   map[rateLimitKey]*rate.Limiter
+	lastSweep time.Time
+}
+
+// rateLimitKey identifies the bucket of a caller for a limit
+type rateLimitKey struct {
+	limit  int
+	caller string
+}
+
+func NewRateLimiter(limits ...RateLimit) (*RateLimiter, error) {
+	for _, limit := range limits {
+		if _, err := path.Match(limit.Method, ""); err != nil {
+			return nil, fmt.Errorf("invalid method pattern %q: %w", limit.Method, err)
+		}
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return nil, fmt.Errorf("the limit of %s must have a positive rate and burst", limit.Method)
+		}
+	}
+
+	return &RateLimiter{
+		limits:    limits,
+		buckets:   make(map[rateLimitKey]*rate.Limiter),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// Allow takes a token from the bucket of the caller, and returns a ResourceExhausted error
+// with the `retry-after` metadata if the bucket is empty
+func (limiter *RateLimiter) Allow(ctx context.Context, method string) error {
+	index := -1
+	for i, limit := range limiter.limits {
+		if matchMethod(limit.Method, method) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	caller := "peer:" + peerAddress(ctx)
+	if user, ok := UserFromContext(ctx); ok {
+		caller = "user:" + user.Username
+	}
+
+	now := time.Now()
+	bucket := limiter.bucket(rateLimitKey{index, caller}, now)
+	if bucket.AllowN(now, 1) {
+		return nil
+	}
+
+	limit := limiter.limits[index]
+	wait := time.Duration((1 - bucket.TokensAt(now)) / limit.Rate * float64(time.Second))
+	quota := &errdetails.QuotaFailure_Violation{
+		Subject:     caller,
+		Description: fmt.Sprintf("%s allows %v calls per second, with bursts of %d", limit.Method, limit.Rate, limit.Burst),
+	}
+	return retryError(ctx, wait, quota, fmt.Sprintf("too many requests to %s, retry in %v", method, wait.Round(time.Millisecond)))
+}
+
+// bucket returns the bucket of the key, creating it if needed
+func (limiter *RateLimiter) bucket(key rateLimitKey, now time.Time) *rate.Limiter {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	// A full bucket behaves like a new one, so dropping it bounds the memory without changing the limits
+	if now.Sub(limiter.lastSweep) >= rateLimitSweepInterval {
+		for key, bucket := range limiter.buckets {
+			if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+				delete(limiter.buckets, key)
+			}
+		}
+		limiter.lastSweep = now
+	}
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		limit := limiter.limits[key.limit]
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		limiter.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// Unary returns a server interceptor function to throttle unary RPC.
+// It must come after the AuthInterceptor in the chain, to know the user of the call.
+func (limiter *RateLimiter) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		err := limiter.Allow(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a server interceptor function to throttle stream RPC. Opening a stream takes a token,
+// and so does every message received on a bidirectional stream.
+func (limiter *RateLimiter) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		err := limiter.Allow(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		if info.IsClientStream && info.IsServerStream {
+			stream = &rateLimitedStream{ServerStream: stream, limiter: limiter, method: info.FullMethod}
+		}
+		return handler(srv, stream)
+	}
+}
+
+type rateLimitedStream struct {
+	grpc.ServerStream
+	limiter *RateLimiter
+	method  string
+}
+
+func (stream *rateLimitedStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	return stream.limiter.Allow(stream.Context(), stream.method)
+}
@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiterBudgets(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := service.NewRateLimiter(
+		service.RateLimit{Method: "/eshaanagg.pcbook.LaptopService/CreateLaptop", Rate: 0.1, Burst: 2},
+		service.RateLimit{Method: "/eshaanagg.pcbook.LaptopService/*", Rate: 0.1, Burst: 1},
+	)
+	require.NoError(t, err)
+
+	user1 := service.ContextWithUser(context.Background(), &service.User{Username: "user1"})
+	user2 := service.ContextWithUser(context.Background(), &service.User{Username: "user2"})
+	const createLaptop = "/eshaanagg.pcbook.LaptopService/CreateLaptop"
+
+	require.NoError(t, limiter.Allow(user1, createLaptop))
+	require.NoError(t, limiter.Allow(user1, createLaptop))
+	st := status.Convert(limiter.Allow(user1, createLaptop))
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 2)
+	require.InDelta(t, 10, st.Details()[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration().Seconds(), 0.1)
+	require.Equal(t, "user:user1", st.Details()[1].(*errdetails.QuotaFailure).GetViolations()[0].GetSubject())
+
+	// Every user and every limit has a bucket of its own
+	require.NoError(t, limiter.Allow(user2, createLaptop))
+	require.NoError(t, limiter.Allow(user1, "/eshaanagg.pcbook.LaptopService/UpdateLaptop"))
+	require.Error(t, limiter.Allow(user1, "/eshaanagg.pcbook.LaptopService/UploadImage"))
+
+	// Methods without a limit are not throttled
+	for i := 0; i < 5; i++ {
+		require.NoError(t, limiter.Allow(user1, "/eshaanagg.pcbook.AuthService/Login"))
+	}
+
+	_, err = service.NewRateLimiter(service.RateLimit{Method: "[", Rate: 1, Burst: 1})
+	require.Error(t, err)
+	_, err = service.NewRateLimiter(service.RateLimit{Method: "*", Rate: 1, Burst: 0})
+	require.Error(t, err)
+}
+
+func TestRateLimiterStreamMessages(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := service.NewRateLimiter(service.RateLimit{Method: "/eshaanagg.pcbook.LaptopService/RateLaptop", Rate: 0.1, Burst: 3})
+	require.NoError(t, err)
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(service.DefaultTenantID, laptop))
+	laptopServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore(), service.DefaultMaxImageSize, nil)
+
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(limiter.Stream()))
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	// Opening the stream takes a token, so the anonymous caller can only send two ratings
+	stream, err := startTestLaptopClient(t, listener.Addr().String()).RateLaptop(context.Background())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.Id, Score: 8}))
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint32(i+1), res.GetRatedCount())
+	}
+	_, err = stream.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"10"}, stream.Trailer().Get("retry-after"))
+}
@@ -1,9 +1,14 @@
 package service
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type RatingStore interface {
-	Add(laptopId string, score float64) *Rating
+	Add(ctx context.Context, tenantID string, laptopId string, score float64) *Rating
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
 }
 
 type Rating struct {
@@ -11,22 +16,29 @@ type Rating struct {
 	Sum   float64
 }
 
+// ratingKey identifies the ratings of a laptop within a tenant
+type ratingKey struct {
+	tenantID string
+	laptopId string
+}
+
 type InMemoryRatingStore struct {
 	mutex  sync.RWMutex
-	rating map[string]*Rating
+	rating map[ratingKey]*Rating
 }
 
 func NewInMemoryRatingStore() *InMemoryRatingStore {
 	return &InMemoryRatingStore{
-		rating: make(map[string]*Rating),
+		rating: make(map[ratingKey]*Rating),
 	}
 }
 
-func (store *InMemoryRatingStore) Add(laptopId string, score float64) *Rating {
+func (store *InMemoryRatingStore) Add(ctx context.Context, tenantID string, laptopId string, score float64) *Rating {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	rating := store.rating[laptopId]
+	key := ratingKey{tenantID, laptopId}
+	rating := store.rating[key]
 	if rating == nil {
 		rating = &Rating{
 			Count: 1,
@@ -37,6 +49,11 @@ func (store *InMemoryRatingStore) Add(laptopId string, score float64) *Rating {
 		rating.Sum += score
 	}
 
-	store.rating[laptopId] = rating
+	store.rating[key] = rating
 	return rating
 }
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryRatingStore) HealthCheck() error {
+	return nil
+}
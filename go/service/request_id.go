@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDKey is the metadata key of the request ID, which is also sent back in the response trailers
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, so that they cannot flood the logs
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a copy of the context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID of the context, which is empty outside of a request
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// RequestIDInterceptor gives every call a request ID, either the one sent by the client or a generated one.
+// It must be the first interceptor of the chain, so that the logs of the other ones carry the ID,
+// even before the RecoveryInterceptor, as it does nothing that can panic.
+type RequestIDInterceptor struct{}
+
+func NewRequestIDInterceptor() *RequestIDInterceptor {
+	return &RequestIDInterceptor{}
+}
+
+// Unary returns a server interceptor function to set the request ID of unary RPC
+func (interceptor *RequestIDInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		requestID := incomingRequestID(ctx)
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(RequestIDKey, requestID))
+		return handler(ContextWithRequestID(ctx, requestID), req)
+	}
+}
+
+// Stream returns a server interceptor function to set the request ID of stream RPC
+func (interceptor *RequestIDInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		requestID := incomingRequestID(stream.Context())
+		stream.SetTrailer(metadata.Pairs(RequestIDKey, requestID))
+		return handler(srv, &requestIDStream{stream, ContextWithRequestID(stream.Context(), requestID)})
+	}
+}
+
+// incomingRequestID returns the request ID sent by the client if it is valid, or a new one
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		values := md.Get(RequestIDKey)
+		if len(values) > 0 && isValidRequestID(values[0]) {
+			return values[0]
+		}
+	}
+
+	return uuid.NewString()
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *requestIDStream) Context() context.Context {
+	return stream.ctx
+}
+
+// NewLogHandler returns a slog handler adding the request ID of the context to every record
+func NewLogHandler(handler slog.Handler) slog.Handler {
+	return &logHandler{handler}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (handler *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,79 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDInterceptor(t *testing.T) {
+	t.Parallel()
+
+	interceptor := service.NewRequestIDInterceptor()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	laptopServer := service.NewLaptopServer(service.NewInMemoryLaptopStore(), nil, service.NewInMemoryRatingStore(), service.DefaultMaxImageSize, nil)
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	laptopClient := startTestLaptopClient(t, listener.Addr().String())
+
+	createLaptop := func(ctx context.Context) string {
+		var trailer metadata.MD
+		_, err := laptopClient.CreateLaptop(ctx, &pb.CreateLaptopRequest{Laptop: sample.NewLaptop()}, grpc.Trailer(&trailer))
+		require.NoError(t, err)
+		require.Len(t, trailer.Get(service.RequestIDKey), 1)
+		return trailer.Get(service.RequestIDKey)[0]
+	}
+
+	// The request ID of the client is kept
+	ctx := metadata.AppendToOutgoingContext(context.Background(), service.RequestIDKey, "client-id-1")
+	require.Equal(t, "client-id-1", createLaptop(ctx))
+
+	// A missing or invalid request ID is replaced with a new one
+	generated := createLaptop(context.Background())
+	require.NotEmpty(t, generated)
+	require.NotEqual(t, generated, createLaptop(context.Background()))
+	ctx = metadata.AppendToOutgoingContext(context.Background(), service.RequestIDKey, "with spaces")
+	require.NotEqual(t, "with spaces", createLaptop(ctx))
+	ctx = metadata.AppendToOutgoingContext(context.Background(), service.RequestIDKey, strings.Repeat("a", 200))
+	require.Len(t, createLaptop(ctx), 36)
+
+	// Streams get a request ID as well
+	stream, err := laptopClient.SearchLaptop(ctx, &pb.SearchLaptopRequest{Filter: &pb.Filter{}})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	require.Len(t, stream.Trailer().Get(service.RequestIDKey), 1)
+}
+
+func TestLogHandler(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	logger := slog.New(service.NewLogHandler(slog.NewJSONHandler(&output, nil))).With("component", "test")
+
+	logger.InfoContext(service.ContextWithRequestID(context.Background(), "abc"), "inside a request")
+	logger.InfoContext(context.Background(), "outside of a request")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"request_id":"abc"`)
+	require.Contains(t, lines[0], `"component":"test"`)
+	require.NotContains(t, lines[1], "request_id")
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTenantID is the tenant of single-tenant deployments, and the tenant of anonymous requests
+const DefaultTenantID = "default"
+
+// RoleSuperAdmin can manage tenants and the users of every tenant
+const RoleSuperAdmin = "superadmin"
+
+// Tenant IDs are used in file paths by the stores, so they are restricted to a safe set of characters
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is an organization with its own isolated catalog, users and ratings
+type Tenant struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// ValidateTenantID checks that a tenant ID is made of lowercase letters, digits and dashes
+func ValidateTenantID(id string) error {
+	if !tenantIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid tenant id %q: must be 1 to 63 lowercase letters, digits or dashes", id)
+	}
+
+	return nil
+}
+
+// tenantFromContext returns the tenant of the authenticated user of the request.
+// Anonymous requests only have access to the default tenant.
+func tenantFromContext(ctx context.Context) string {
+	user, ok := UserFromContext(ctx)
+	if !ok || user.TenantID == "" {
+		return DefaultTenantID
+	}
+
+	return user.TenantID
+}
+
+type TenantStore interface {
+	Save(tenant *Tenant) error
+	Find(id string) (*Tenant, error)
+	List() ([]*Tenant, error)
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
+}
+
+// InMemoryTenantStore stores tenants in memory
+type InMemoryTenantStore struct {
+	mutex   sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// NewInMemoryTenantStore returns a new in-memory tenant store
+func NewInMemoryTenantStore() *InMemoryTenantStore {
+	return &InMemoryTenantStore{
+		tenants: make(map[string]*Tenant),
+	}
+}
+
+func (store *InMemoryTenantStore) Save(tenant *Tenant) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.tenants[tenant.ID] != nil {
+		return ErrAlreadyExists
+	}
+
+	other := *tenant
+	store.tenants[tenant.ID] = &other
+	return nil
+}
+
+func (store *InMemoryTenantStore) Find(id string) (*Tenant, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	tenant := store.tenants[id]
+	if tenant == nil {
+		return nil, nil
+	}
+
+	other := *tenant
+	return &other, nil
+}
+
+// List returns all the tenants ordered by id
+func (store *InMemoryTenantStore) List() ([]*Tenant, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	tenants := make([]*Tenant, 0, len(store.tenants))
+	for _, tenant := range store.tenants {
+		other := *tenant
+		tenants = append(tenants, &other)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+// CreateTenant validates and saves a new tenant
+func CreateTenant(tenantStore TenantStore, id string, name string) (*Tenant, error) {
+	err := ValidateTenantID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := &Tenant{ID: id, Name: name, CreatedAt: time.Now()}
+	err = tenantStore.Save(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant, nil
+}
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryTenantStore) HealthCheck() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Client certificate modes of the server
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// LoadServerTLSConfig loads the certificate of the server. If the client auth mode is optional or require,
+// client certificates are verified against the CA bundle.
+func LoadServerTLSConfig(certFile string, keyFile string, clientCAFile string, clientAuth string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load server certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch clientAuth {
+	case "", ClientAuthNone:
+		config.ClientAuth = tls.NoClientCert
+		return config, nil
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode: %s", clientAuth)
+	}
+
+	if clientCAFile == "" {
+		return nil, errors.New("a client CA bundle is required to verify client certificates")
+	}
+	config.ClientCAs, err = LoadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates
+func LoadCertPool(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in the CA bundle %s", filename)
+	}
+
+	return pool, nil
+}
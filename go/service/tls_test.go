@@ -0,0 +1,237 @@
+package service_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const mutualTLSPolicy = `
+roles:
+  vendor: {}
+rules:
+  - methods: [/eshaanagg.pcbook.LaptopService/CreateLaptop]
+    roles: [vendor]
+`
+
+// testCA is a throwaway certificate authority for the TLS tests
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pcbook test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{certificate, key}
+}
+
+// issue signs a new certificate, and returns it as a key pair along with the paths of its PEM files
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0600))
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return pair, certFile, keyFile
+}
+
+func (ca *testCA) writePEM(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0600)
+	require.NoError(t, err)
+	return filename
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	_, serverCert, serverKey := ca.issue(t, &x509.Certificate{
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCertificate, _, _ := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "vendor1", OrganizationalUnit: []string{"vendor"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	rogueCertificate, _, _ := newTestCA(t).issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "admin1", OrganizationalUnit: []string{"vendor"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	caFile := ca.writePEM(t)
+	rootCAs, err := service.LoadCertPool(caFile)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		clientAuth   string
+		certificates []tls.Certificate
+		code         codes.Code
+	}{
+		{
+			name:         "Verified client certificate",
+			clientAuth:   service.ClientAuthRequire,
+			certificates: []tls.Certificate{clientCertificate},
+			code:         codes.OK,
+		},
+		{
+			name:       "Missing required client certificate",
+			clientAuth: service.ClientAuthRequire,
+			code:       codes.Unavailable,
+		},
+		{
+			name:         "Client certificate from an unknown CA",
+			clientAuth:   service.ClientAuthRequire,
+			certificates: []tls.Certificate{rogueCertificate},
+			code:         codes.Unavailable,
+		},
+		{
+			name:       "Missing optional client certificate",
+			clientAuth: service.ClientAuthOptional,
+			code:       codes.Unauthenticated,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			serverConfig, err := service.LoadServerTLSConfig(serverCert, serverKey, caFile, tc.clientAuth)
+			require.NoError(t, err)
+			policy, err := service.ParsePolicy([]byte(mutualTLSPolicy), "yaml")
+			require.NoError(t, err)
+
+			store := service.NewInMemoryLaptopStore()
+			interceptor := service.NewAuthInterceptor(service.NewJWTManager("secret", time.Minute), nil, service.NewCertificateMapper(nil, nil), policy, nil)
+			grpcServer := grpc.NewServer(
+				grpc.Creds(credentials.NewTLS(serverConfig)),
+				grpc.UnaryInterceptor(interceptor.Unary()),
+			)
+			pb.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(store, nil, nil, service.DefaultMaxImageSize, nil))
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go grpcServer.Serve(listener)
+			defer grpcServer.Stop()
+
+			clientConfig := &tls.Config{RootCAs: rootCAs, Certificates: tc.certificates, MinVersion: tls.VersionTLS12}
+			conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			laptop := sample.NewLaptop()
+			_, err = pb.NewLaptopServiceClient(conn).CreateLaptop(ctx, &pb.CreateLaptopRequest{Laptop: laptop})
+			require.Equal(t, tc.code, status.Code(err), "%v", err)
+
+			if tc.code == codes.OK {
+				owner, err := store.Owner(service.DefaultTenantID, laptop.Id)
+				require.NoError(t, err)
+				require.Equal(t, "vendor1", owner)
+			}
+		})
+	}
+}
+
+func TestCertificateMapperTenant(t *testing.T) {
+	t.Parallel()
+
+	tenantStore := service.NewInMemoryTenantStore()
+	_, err := service.CreateTenant(tenantStore, service.DefaultTenantID, "Default")
+	require.NoError(t, err)
+	_, err = service.CreateTenant(tenantStore, "acme", "Acme")
+	require.NoError(t, err)
+	mapper := service.NewCertificateMapper(nil, tenantStore)
+
+	certificate := func(organization ...string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: "vendor1", OrganizationalUnit: []string{"vendor"}, Organization: organization}}
+	}
+
+	user, err := mapper.UserFromCertificate(certificate())
+	require.NoError(t, err)
+	require.Equal(t, service.DefaultTenantID, user.TenantID)
+
+	user, err = mapper.UserFromCertificate(certificate("acme"))
+	require.NoError(t, err)
+	require.Equal(t, "acme", user.TenantID)
+
+	_, err = mapper.UserFromCertificate(certificate("Acme Corp/../globex"))
+	require.Error(t, err)
+
+	_, err = mapper.UserFromCertificate(certificate("globex"))
+	require.Error(t, err)
+}
+
+func TestLoadServerTLSConfigRequiresClientCA(t *testing.T) {
+	t.Parallel()
+
+	_, certFile, keyFile := newTestCA(t).issue(t, &x509.Certificate{DNSNames: []string{"localhost"}})
+
+	_, err := service.LoadServerTLSConfig(certFile, keyFile, "", service.ClientAuthRequire)
+	require.Error(t, err)
+
+	_, err = service.LoadServerTLSConfig(certFile, keyFile, "", "sometimes")
+	require.Error(t, err)
+
+	config, err := service.LoadServerTLSConfig(certFile, keyFile, "", service.ClientAuthNone)
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, config.ClientAuth)
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// tracerName is the instrumentation scope of the spans created by the service package
+const tracerName = "github.com/eshaanagg/pcbook/go/service"
+
+// Exporters of the spans
+const (
+	// TraceExporterNone records the spans, for propagation, without exporting them
+	TraceExporterNone = "none"
+	// TraceExporterStdout writes the spans to the standard output as JSON
+	TraceExporterStdout = "stdout"
+	// TraceExporterFile writes the spans as JSON to a file, which works offline and in tests
+	TraceExporterFile = "file"
+	// TraceExporterOTLP sends the spans to an OpenTelemetry collector over gRPC
+	TraceExporterOTLP = "otlp"
+)
+
+// TracerProvider is a tracer provider that also closes the file its spans are written to, if any
+type TracerProvider struct {
+	*sdktrace.TracerProvider
+	file *os.File
+}
+
+// NewTracerProvider returns the provider of the spans of a service, exported with the given exporter.
+// The target is the file of the file exporter, or the host:port of the collector of the OTLP exporter.
+// A fraction of the traces is sampled, following the decision of the caller for traces it started.
+func NewTracerProvider(ctx context.Context, serviceName string, exporter string, target string, insecure bool, sampleRatio float64) (*TracerProvider, error) {
+	provider := &TracerProvider{}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	}
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case TraceExporterNone:
+	case TraceExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case TraceExporterFile:
+		provider.file, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open trace file: %w", err)
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(provider.file))
+	case TraceExporterOTLP:
+		clientOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(target)}
+		if insecure {
+			clientOptions = append(clientOptions, otlptracegrpc.WithInsecure())
+		}
+		spanExporter, err = otlptracegrpc.New(ctx, clientOptions...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		if provider.file != nil {
+			provider.file.Close()
+		}
+		return nil, fmt.Errorf("cannot create %s trace exporter: %w", exporter, err)
+	}
+
+	if spanExporter != nil {
+		options = append(options, sdktrace.WithBatcher(spanExporter))
+	}
+	provider.TracerProvider = sdktrace.NewTracerProvider(options...)
+	return provider, nil
+}
+
+// Close exports the pending spans and stops the provider
+func (provider *TracerProvider) Close() error {
+	err := provider.Shutdown(context.Background())
+	if provider.file != nil {
+		err = errors.Join(err, provider.file.Close())
+	}
+	return err
+}
+
+// Tracing creates the spans of the RPC and of the stores, and propagates the W3C trace context through the gRPC metadata
+type Tracing struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	tracer     trace.Tracer
+}
+
+func NewTracing(provider trace.TracerProvider) *Tracing {
+	return &Tracing{
+		provider:   provider,
+		propagator: propagation.TraceContext{},
+		tracer:     provider.Tracer(tracerName),
+	}
+}
+
+func (tracing *Tracing) options() []otelgrpc.Option {
+	return []otelgrpc.Option{otelgrpc.WithTracerProvider(tracing.provider), otelgrpc.WithPropagators(tracing.propagator)}
+}
+
+// Unary returns a server interceptor function to trace unary RPC, continuing the trace of the client
+func (tracing *Tracing) Unary() grpc.UnaryServerInterceptor {
+	return otelgrpc.UnaryServerInterceptor(tracing.options()...)
+}
+
+// Stream returns a server interceptor function to trace stream RPC, continuing the trace of the client
+func (tracing *Tracing) Stream() grpc.StreamServerInterceptor {
+	return otelgrpc.StreamServerInterceptor(tracing.options()...)
+}
+
+// UnaryClient returns a client interceptor function to trace unary RPC and send the trace context to the server
+func (tracing *Tracing) UnaryClient() grpc.UnaryClientInterceptor {
+	return otelgrpc.UnaryClientInterceptor(tracing.options()...)
+}
+
+// StreamClient returns a client interceptor function to trace stream RPC and send the trace context to the server
+func (tracing *Tracing) StreamClient() grpc.StreamClientInterceptor {
+	return otelgrpc.StreamClientInterceptor(tracing.options()...)
+}
+
+// LaptopStore returns the store tracing the searches
+func (tracing *Tracing) LaptopStore(store LaptopStore) LaptopStore {
+	return &tracedLaptopStore{store, tracing.tracer}
+}
+
+// ImageStore returns the store tracing the saved images
+func (tracing *Tracing) ImageStore(store ImageStore) ImageStore {
+	return &tracedImageStore{store, tracing.tracer}
+}
+
+// RatingStore returns the store tracing the added ratings
+func (tracing *Tracing) RatingStore(store RatingStore) RatingStore {
+	return &tracedRatingStore{store, tracing.tracer}
+}
+
+// endSpan records the error of the operation, if any, and ends its span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type tracedLaptopStore struct {
+	LaptopStore
+	tracer trace.Tracer
+}
+
+func (store *tracedLaptopStore) Search(ctx context.Context, tenantID string, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
+	ctx, span := store.tracer.Start(ctx, "LaptopStore.Search", trace.WithAttributes(attribute.String("pcbook.tenant_id", tenantID)))
+	count := 0
+	err := store.LaptopStore.Search(ctx, tenantID, filter, func(laptop *pb.Laptop) error {
+		count++
+		return found(laptop)
+	})
+	span.SetAttributes(attribute.Int("pcbook.laptops_found", count))
+	endSpan(span, err)
+	return err
+}
+
+type tracedImageStore struct {
+	ImageStore
+	tracer trace.Tracer
+}
+
+func (store *tracedImageStore) Save(ctx context.Context, tenantID string, laptopId string, imageType string, imageData bytes.Buffer) (string, error) {
+	ctx, span := store.tracer.Start(ctx, "ImageStore.Save", trace.WithAttributes(
+		attribute.String("pcbook.tenant_id", tenantID),
+		attribute.String("pcbook.laptop_id", laptopId),
+		attribute.Int("pcbook.image_size", imageData.Len()),
+	))
+	imageID, err := store.ImageStore.Save(ctx, tenantID, laptopId, imageType, imageData)
+	endSpan(span, err)
+	return imageID, err
+}
+
+type tracedRatingStore struct {
+	RatingStore
+	tracer trace.Tracer
+}
+
+func (store *tracedRatingStore) Add(ctx context.Context, tenantID string, laptopId string, score float64) *Rating {
+	ctx, span := store.tracer.Start(ctx, "RatingStore.Add", trace.WithAttributes(
+		attribute.String("pcbook.tenant_id", tenantID),
+		attribute.String("pcbook.laptop_id", laptopId),
+	))
+	defer span.End()
+	return store.RatingStore.Add(ctx, tenantID, laptopId, score)
+}
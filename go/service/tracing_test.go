@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/service"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	t.Parallel()
+
+	serverSpans := tracetest.NewInMemoryExporter()
+	serverTracing := service.NewTracing(sdktrace.NewTracerProvider(sdktrace.WithSyncer(serverSpans)))
+	clientSpans := tracetest.NewInMemoryExporter()
+	clientTracing := service.NewTracing(sdktrace.NewTracerProvider(sdktrace.WithSyncer(clientSpans)))
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	require.NoError(t, laptopStore.Save(service.DefaultTenantID, sample.NewLaptop()))
+	laptopServer := service.NewLaptopServer(serverTracing.LaptopStore(laptopStore), nil, nil, service.DefaultMaxImageSize, nil)
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(serverTracing.Unary()),
+		grpc.StreamInterceptor(serverTracing.Stream()),
+	)
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(
+		listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(clientTracing.StreamClient()),
+	)
+	require.NoError(t, err)
+	stream, err := pb.NewLaptopServiceClient(conn).SearchLaptop(context.Background(), &pb.SearchLaptopRequest{Filter: &pb.Filter{}})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	require.ErrorIs(t, err, io.EOF)
+	grpcServer.GracefulStop()
+
+	require.Len(t, clientSpans.GetSpans(), 1)
+	clientSpan := clientSpans.GetSpans()[0]
+	require.Equal(t, "eshaanagg.pcbook.LaptopService/SearchLaptop", clientSpan.Name)
+
+	spans := serverSpans.GetSpans()
+	require.Len(t, spans, 2)
+	storeSpan, rpcSpan := spans[0], spans[1]
+	require.Equal(t, "LaptopStore.Search", storeSpan.Name)
+	require.Equal(t, "eshaanagg.pcbook.LaptopService/SearchLaptop", rpcSpan.Name)
+
+	// The server continues the trace of the client, and the store span is a child of the RPC span
+	require.Equal(t, clientSpan.SpanContext.TraceID(), rpcSpan.SpanContext.TraceID())
+	require.Equal(t, clientSpan.SpanContext.SpanID(), rpcSpan.Parent.SpanID())
+	require.Equal(t, rpcSpan.SpanContext.SpanID(), storeSpan.Parent.SpanID())
+}
+
+func TestTracerProviderFileExporter(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "spans.json")
+	provider, err := service.NewTracerProvider(context.Background(), "test", service.TraceExporterFile, filename, false, 1)
+	require.NoError(t, err)
+
+	_, span := provider.Tracer("test").Start(context.Background(), "operation")
+	span.End()
+	require.NoError(t, provider.Close())
+
+	content, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"Name":"operation"`)
+
+	_, err = service.NewTracerProvider(context.Background(), "test", "jaeger", "", false, 1)
+	require.Error(t, err)
+}
@@ -2,26 +2,43 @@ package service
 
 import (
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Roles with a special meaning for the laptop service. Admins can modify any laptop, while
+// vendors can create laptops and only modify the ones they own.
+const (
+	RoleAdmin  = "admin"
+	RoleVendor = "vendor"
+)
+
 type User struct {
 	Username       string
 	HashedPassword string
 	Role           string
+	TenantID       string
+	// Disabled users keep their account but cannot log in
+	Disabled  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-func NewUser(username string, password string, role string) (*User, error) {
+func NewUser(username string, password string, role string, tenantID string) (*User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("cannot hash the password: %v", err)
 	}
 
+	now := time.Now()
 	user := User{
 		Username:       username,
 		HashedPassword: string(hashedPassword),
 		Role:           role,
+		TenantID:       tenantID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
 	}
 
 	return &user, nil
@@ -37,5 +54,9 @@ func (user *User) Clone() *User {
 		Username:       user.Username,
 		HashedPassword: user.HashedPassword,
 		Role:           user.Role,
+		TenantID:       user.TenantID,
+		Disabled:       user.Disabled,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
 	}
 }
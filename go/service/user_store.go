@@ -1,10 +1,20 @@
 package service
 
-import "sync"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
 
 type UserStore interface {
 	Save(user *User) error
+	// Update replaces an existing user and sets the time it was updated
+	Update(user *User) error
 	Find(username string) (*User, error)
+	// HealthCheck returns an error if the store cannot serve requests
+	HealthCheck() error
 }
 
 // InMemoryUserStore stores users in memory
@@ -32,6 +42,20 @@ func (store *InMemoryUserStore) Save(user *User) error {
 	return nil
 }
 
+func (store *InMemoryUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.users[user.Username] == nil {
+		return ErrNotFound
+	}
+
+	updated := user.Clone()
+	updated.UpdatedAt = time.Now()
+	store.users[user.Username] = updated
+	return nil
+}
+
 func (store *InMemoryUserStore) Find(username string) (*User, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
@@ -43,11 +67,44 @@ func (store *InMemoryUserStore) Find(username string) (*User, error) {
 
 	return user.Clone(), nil
 }
-func CreateUser(userStore UserStore, username, password, role string) error {
-	user, err := NewUser(username, password, role)
+func CreateUser(userStore UserStore, username, password, role, tenantID string) error {
+	user, err := NewUser(username, password, role, tenantID)
 	if err != nil {
 		return err
 	}
 
 	return userStore.Save(user)
 }
+
+// BootstrapAdmin creates the initial super admin of the default tenant if it does not exist yet.
+// A random password is generated when none is given, and returned so that it can be shown once.
+// It returns an empty password if the user already exists.
+func BootstrapAdmin(userStore UserStore, username string, password string) (string, error) {
+	user, err := userStore.Find(username)
+	if err != nil {
+		return "", err
+	}
+	if user != nil {
+		return "", nil
+	}
+
+	if password == "" {
+		random := make([]byte, 18)
+		if _, err := rand.Read(random); err != nil {
+			return "", fmt.Errorf("cannot generate password: %w", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(random)
+	}
+
+	err = CreateUser(userStore, username, password, RoleSuperAdmin, DefaultTenantID)
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// HealthCheck always succeeds, as the store is in memory
+func (store *InMemoryUserStore) HealthCheck() error {
+	return nil
+}
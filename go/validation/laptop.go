@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/google/uuid"
+)
+
+// MemoryRules are the rules of a memory size, such as the RAM or the capacity of a storage
+var MemoryRules = []Rule[*pb.Memory]{
+	Positive("value", (*pb.Memory).GetValue),
+	Known("unit", (*pb.Memory).GetUnit),
+}
+
+// CPURules are the rules of a CPU, whose frequencies are in GHz
+var CPURules = []Rule[*pb.CPU]{
+	NotEmpty("brand", (*pb.CPU).GetBrand),
+	NotEmpty("name", (*pb.CPU).GetName),
+	Positive("number_cores", (*pb.CPU).GetNumberCores),
+	Check("number_threads", func(cpu *pb.CPU) bool {
+		return cpu.GetNumberThreads() >= cpu.GetNumberCores()
+	}, "must not be less than number_cores"),
+	Positive("min_ghz", (*pb.CPU).GetMinGhz),
+	Check("min_ghz", func(cpu *pb.CPU) bool {
+		return cpu.GetMinGhz() <= cpu.GetMaxGhz()
+	}, "must not be greater than max_ghz"),
+}
+
+// GPURules are the rules of a GPU and of its memory
+var GPURules = []Rule[*pb.GPU]{
+	NotEmpty("brand", (*pb.GPU).GetBrand),
+	NotEmpty("name", (*pb.GPU).GetName),
+	Positive("min_ghz", (*pb.GPU).GetMinGhz),
+	Check("min_ghz", func(gpu *pb.GPU) bool {
+		return gpu.GetMinGhz() <= gpu.GetMaxGhz()
+	}, "must not be greater than max_ghz"),
+	Message("memory", (*pb.GPU).GetMemory, MemoryRules),
+}
+
+// StorageRules are the rules of a storage drive
+var StorageRules = []Rule[*pb.Storage]{
+	Known("driver", (*pb.Storage).GetDriver),
+	Message("memory", (*pb.Storage).GetMemory, MemoryRules),
+}
+
+// ResolutionRules are the rules of a screen resolution, in pixels
+var ResolutionRules = []Rule[*pb.Screen_Resolution]{
+	Positive("width", (*pb.Screen_Resolution).GetWidth),
+	Positive("height", (*pb.Screen_Resolution).GetHeight),
+}
+
+// ScreenRules are the rules of a screen
+var ScreenRules = []Rule[*pb.Screen]{
+	Positive("size_inch", (*pb.Screen).GetSizeInch),
+	Message("resolution", (*pb.Screen).GetResolution, ResolutionRules),
+	Known("panel", (*pb.Screen).GetPanel),
+}
+
+// LaptopRules are the rules of a new laptop. The ID is optional, as the server generates one for new laptops.
+var LaptopRules = []Rule[*pb.Laptop]{
+	Check("id", func(laptop *pb.Laptop) bool {
+		_, err := uuid.Parse(laptop.GetId())
+		return laptop.GetId() == "" || err == nil
+	}, "must be a valid UUID"),
+	NotEmpty("brand", (*pb.Laptop).GetBrand),
+	NotEmpty("name", (*pb.Laptop).GetName),
+	Message("cpu", (*pb.Laptop).GetCpu, CPURules),
+	Message("ram", (*pb.Laptop).GetRam, MemoryRules),
+	Each("gpus", (*pb.Laptop).GetGpus, GPURules),
+	Each("storages", (*pb.Laptop).GetStorages, StorageRules),
+	Message("screen", (*pb.Laptop).GetScreen, ScreenRules),
+	validateWeight,
+	NotNegative("price_usd", (*pb.Laptop).GetPriceUsd),
+}
+
+// validateWeight checks the weight, which is given in either unit
+func validateWeight(violations *Violations, path string, laptop *pb.Laptop) {
+	switch weight := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		if weight.WeightKg <= 0 {
+			violations.Add(Field(path, "weight_kg"), "must be positive")
+		}
+	case *pb.Laptop_WeightLb:
+		if weight.WeightLb <= 0 {
+			violations.Add(Field(path, "weight_lb"), "must be positive")
+		}
+	default:
+		violations.Add(Field(path, "weight"), "is required")
+	}
+}
+
+// ValidateLaptop returns an InvalidArgument status error listing every invalid field of a new laptop, if any
+func ValidateLaptop(laptop *pb.Laptop) error {
+	violations := &Violations{}
+	validateLaptop(violations, laptop)
+	return violations.Err()
+}
+
+// ValidateLaptopUpdate is like ValidateLaptop, for a laptop replacing an existing one, whose ID is required
+func ValidateLaptopUpdate(laptop *pb.Laptop) error {
+	violations := &Violations{}
+	if laptop != nil && laptop.GetId() == "" {
+		violations.Add("id", "is required")
+	}
+	validateLaptop(violations, laptop)
+	return violations.Err()
+}
+
+func validateLaptop(violations *Violations, laptop *pb.Laptop) {
+	if laptop == nil {
+		violations.Add("laptop", "is required")
+		return
+	}
+
+	Validate(violations, "", laptop, LaptopRules)
+}
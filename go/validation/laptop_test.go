@@ -0,0 +1,83 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/eshaanagg/pcbook/go/pb"
+	"github.com/eshaanagg/pcbook/go/sample"
+	"github.com/eshaanagg/pcbook/go/validation"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fieldViolations returns the paths of the fields reported by the BadRequest detail of the error
+func fieldViolations(t *testing.T, err error) []string {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	fields := make([]string, len(badRequest.GetFieldViolations()))
+	for i, violation := range badRequest.GetFieldViolations() {
+		fields[i] = violation.GetField()
+	}
+	return fields
+}
+
+func TestValidateLaptop(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, validation.ValidateLaptop(sample.NewLaptop()))
+
+	laptop := sample.NewLaptop()
+	laptop.Id = "invalid_uuid"
+	laptop.Cpu.MinGhz = laptop.Cpu.MaxGhz + 1
+	laptop.Storages[1].Memory.Unit = pb.Memory_UNKNOWN
+	laptop.Gpus[0].Memory = nil
+
+	err := validation.ValidateLaptop(laptop)
+	require.Equal(t, []string{"id", "cpu.min_ghz", "gpus[0].memory", "storages[1].memory.unit"}, fieldViolations(t, err))
+	require.Contains(t, err.Error(), "storages[1].memory.unit: must be set")
+
+	require.Equal(t, []string{"laptop"}, fieldViolations(t, validation.ValidateLaptop(nil)))
+
+	laptop = sample.NewLaptop()
+	laptop.Id = ""
+	require.NoError(t, validation.ValidateLaptop(laptop))
+	require.Equal(t, []string{"id"}, fieldViolations(t, validation.ValidateLaptopUpdate(laptop)))
+}
+
+func TestValidateLaptopReportsEveryViolation(t *testing.T) {
+	t.Parallel()
+
+	laptop := sample.NewLaptop()
+	laptop.Brand = ""
+	laptop.Cpu.NumberThreads = laptop.Cpu.NumberCores - 1
+	laptop.Gpus[0].MaxGhz = laptop.Gpus[0].MinGhz - 0.5
+	laptop.Storages[0].Driver = pb.Storage_UNKNOWN
+	laptop.Screen.Resolution.Height = 0
+	laptop.Screen.Panel = pb.Screen_UNKNOWN
+	laptop.Weight = &pb.Laptop_WeightKg{WeightKg: 0}
+	laptop.PriceUsd = -1
+
+	require.Equal(t, []string{
+		"brand",
+		"cpu.number_threads",
+		"gpus[0].min_ghz",
+		"storages[0].driver",
+		"screen.resolution.height",
+		"screen.panel",
+		"weight_kg",
+		"price_usd",
+	}, fieldViolations(t, validation.ValidateLaptop(laptop)))
+
+	laptop = sample.NewLaptop()
+	laptop.Ram = nil
+	laptop.Screen = nil
+	laptop.Weight = nil
+	require.Equal(t, []string{"ram", "screen", "weight"}, fieldViolations(t, validation.ValidateLaptop(laptop)))
+}
@@ -0,0 +1,71 @@
+package validation
+
+import "fmt"
+
+// Rule checks a message of type T, and adds the violations it finds under the path of the message
+type Rule[T any] func(violations *Violations, path string, message T)
+
+// Validate checks the message against every rule, so that all the violations are reported at once
+func Validate[T any](violations *Violations, path string, message T, rules []Rule[T]) {
+	for _, rule := range rules {
+		rule(violations, path, message)
+	}
+}
+
+// Check is a rule reporting the field when the predicate is false
+func Check[T any](field string, predicate func(message T) bool, format string, args ...interface{}) Rule[T] {
+	description := fmt.Sprintf(format, args...)
+	return func(violations *Violations, path string, message T) {
+		if !predicate(message) {
+			violations.Add(Field(path, field), "%s", description)
+		}
+	}
+}
+
+// NotEmpty is a rule reporting an empty string field
+func NotEmpty[T any](field string, get func(message T) string) Rule[T] {
+	return Check(field, func(message T) bool { return get(message) != "" }, "must not be empty")
+}
+
+// Positive is a rule reporting a numeric field that is zero or negative
+func Positive[T any, N int32 | int64 | uint32 | uint64 | float32 | float64](field string, get func(message T) N) Rule[T] {
+	return Check(field, func(message T) bool { return get(message) > 0 }, "must be positive")
+}
+
+// NotNegative is a rule reporting a negative numeric field
+func NotNegative[T any, N int32 | int64 | float32 | float64](field string, get func(message T) N) Rule[T] {
+	return Check(field, func(message T) bool { return get(message) >= 0 }, "must not be negative")
+}
+
+// Known is a rule reporting an enum field left to its UNKNOWN zero value
+func Known[T any, E ~int32](field string, get func(message T) E) Rule[T] {
+	return Check(field, func(message T) bool { return get(message) != 0 }, "must be set")
+}
+
+// Message is a rule checking a required nested message with its own rules
+func Message[T any, M comparable](field string, get func(message T) M, rules []Rule[M]) Rule[T] {
+	return func(violations *Violations, path string, message T) {
+		var zero M
+		nested := get(message)
+		if nested == zero {
+			violations.Add(Field(path, field), "is required")
+			return
+		}
+		Validate(violations, Field(path, field), nested, rules)
+	}
+}
+
+// Each is a rule checking every element of a repeated message field, which may be empty
+func Each[T any, M comparable](field string, get func(message T) []M, rules []Rule[M]) Rule[T] {
+	return func(violations *Violations, path string, message T) {
+		for i, element := range get(message) {
+			elementPath := Index(Field(path, field), i)
+			var zero M
+			if element == zero {
+				violations.Add(elementPath, "is required")
+				continue
+			}
+			Validate(violations, elementPath, element, rules)
+		}
+	}
+}
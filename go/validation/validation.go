@@ -0,0 +1,65 @@
+// Package validation checks the messages sent to the pcbook services. The invalid fields are reported
+// as google.rpc.BadRequest field violations, so that clients can tell exactly which field failed.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Violations collects the invalid fields of a message, with paths such as `storages[1].memory.unit`
+type Violations struct {
+	list []*errdetails.BadRequest_FieldViolation
+}
+
+// Add records that the field is invalid
+func (violations *Violations) Add(field string, format string, args ...interface{}) {
+	violations.list = append(violations.list, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// List returns the violations in the order they were found
+func (violations *Violations) List() []*errdetails.BadRequest_FieldViolation {
+	return violations.list
+}
+
+// Err returns nil if there is no violation, or else an InvalidArgument status error
+// carrying every violation in a BadRequest detail
+func (violations *Violations) Err() error {
+	if len(violations.list) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, len(violations.list))
+	for i, violation := range violations.list {
+		descriptions[i] = violation.GetField() + ": " + violation.GetDescription()
+	}
+
+	st := status.New(codes.InvalidArgument, "invalid "+strings.Join(descriptions, ", "))
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations.list})
+	if err != nil {
+		// Only fails if the detail cannot be marshalled, the message alone still describes the violations
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// Field returns the path of a field of the message at the parent path
+func Field(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// Index returns the path of an element of the repeated field at the path
+func Index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}